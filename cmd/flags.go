@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// headersFlag collects repeated "host=Name: value" flags.
+type headersFlag map[string]http.Header
+
+func (h headersFlag) String() string {
+	var parts []string
+	for host, header := range h {
+		for name, values := range header {
+			for _, value := range values {
+				parts = append(parts, host+"="+name+": "+value)
+			}
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (h headersFlag) Set(value string) error {
+	eq := strings.Index(value, "=")
+	colon := strings.Index(value, ":")
+	if eq <= 0 || colon < eq+2 {
+		return fmt.Errorf("expected host=Name: value, got %q", value)
+	}
+
+	host := value[:eq]
+	if h[host] == nil {
+		h[host] = make(http.Header)
+	}
+	h[host].Add(strings.TrimSpace(value[eq+1:colon]), strings.TrimSpace(value[colon+1:]))
+	return nil
+}
+
+// readFile adds "host=Name: value" lines of the file, so credentials don't show up in the command line.
+func (h headersFlag) readFile(path string) error {
+	if path == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := h.Set(line); err != nil {
+			return errors.Wrapf(err, "invalid header in %s", path)
+		}
+	}
+	return nil
+}
+
+// splitList splits a comma separated flag value, an empty value gives an empty non-nil list.
+func splitList(value string) []string {
+	list := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
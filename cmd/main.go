@@ -7,19 +7,124 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"runtime"
+	"strings"
+	"syscall"
 	"time"
 
 	"go.uber.org/zap"
 
 	"github.com/ivanovaleksey/resizer/internal/pkg/app"
+	"github.com/ivanovaleksey/resizer/internal/pkg/imagestore"
+	"github.com/ivanovaleksey/resizer/internal/pkg/resizer"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "sign" {
+		os.Exit(sign(os.Args[2:]))
+	}
+
 	imgProvider := flag.Int("image_provider", 1, "1 - http, 2 - file")
+	fileRoot := flag.String("file_root", "", "directory the file provider serves from, required by it; empty disables the file provider")
+	qualityMin := flag.Int("quality_min", 1, "minimal JPEG quality a client may request")
+	qualityMax := flag.Int("quality_max", 100, "maximal JPEG quality a client may request")
+	qualityDefault := flag.Int("quality_default", 75, "JPEG quality used when a request has none")
+	sourceMaxWidth := flag.Int("source_max_width", 16384, "maximal width of a source image, negative disables the limit")
+	sourceMaxHeight := flag.Int("source_max_height", 16384, "maximal height of a source image, negative disables the limit")
+	sourceMaxMegapixels := flag.Float64("source_max_megapixels", 50, "maximal megapixels of a source image, negative disables the limit")
+	outputMaxWidth := flag.Int("output_max_width", 8192, "maximal requested width, negative disables the limit")
+	outputMaxHeight := flag.Int("output_max_height", 8192, "maximal requested height, negative disables the limit")
+	outputMaxMegapixels := flag.Float64("output_max_megapixels", 40, "maximal requested megapixels, negative disables the limit")
+	workers := flag.Int("workers", runtime.GOMAXPROCS(0), "maximal number of images processed at once")
+	workerQueueSize := flag.Int("worker_queue_size", 4*runtime.GOMAXPROCS(0), "maximal number of requests waiting for a worker, negative disables the queue")
+	workerQueueWait := flag.Duration("worker_queue_wait", resizer.DefaultQueueWait, "maximal wait for a worker before a request is shed with 503")
+	maxBodySize := flag.Int64("http_max_body_size", imagestore.DefaultMaxBodySize, "maximal size of an upstream image in bytes")
+	dialTimeout := flag.Duration("http_dial_timeout", 2*time.Second, "upstream connection timeout")
+	tlsTimeout := flag.Duration("http_tls_timeout", 2*time.Second, "upstream TLS handshake timeout")
+	headerTimeout := flag.Duration("http_header_timeout", 5*time.Second, "upstream response header timeout")
+	totalTimeout := flag.Duration("http_timeout", 8*time.Second, "total upstream fetch timeout including retries")
+	maxIdleConns := flag.Int("http_max_idle_conns_per_host", 16, "keep-alive connections per upstream host")
+	retries := flag.Int("http_retries", 2, "retries of 5xx and network errors, negative disables them")
+	retryBaseDelay := flag.Duration("http_retry_base_delay", 100*time.Millisecond, "initial delay between retries")
+	retryMaxDelay := flag.Duration("http_retry_max_delay", time.Second, "maximal delay between retries")
+	userAgent := flag.String("http_user_agent", imagestore.DefaultUserAgent, "User-Agent of upstream requests")
+	allowedHosts := flag.String("http_allowed_hosts", "", "comma separated glob patterns of allowed upstream hosts, empty allows any")
+	deniedNetworks := flag.String("http_denied_networks", strings.Join(imagestore.DefaultDeniedNetworks, ","), "comma separated CIDRs upstream addresses must not belong to")
+	maxRedirects := flag.Int("http_max_redirects", 3, "maximal number of upstream redirects, negative disables them")
+	presetsFile := flag.String("presets_file", "", "YAML or JSON file with named presets, reloaded on SIGHUP")
+	presetsOnly := flag.Bool("presets_only", false, "reject requests which don't use a preset")
+	signatureKeysFile := flag.String("signature_keys_file", "", "file with comma or newline separated signing keys, the first one is current; defaults to $"+signatureKeysEnv+", no keys disable signing")
+	thumborKeysFile := flag.String("thumbor_keys_file", "", "file with thumbor security keys signing /thumbor/ paths; defaults to $"+thumborKeysEnv)
+	imgproxyKeysFile := flag.String("imgproxy_keys_file", "", "file with hex encoded imgproxy keys signing /imgproxy/ paths; defaults to $"+imgproxyKeysEnv)
+	imgproxySaltsFile := flag.String("imgproxy_salts_file", "", "file with hex encoded imgproxy salts paired with the keys; defaults to $"+imgproxySaltsEnv)
+	headers := headersFlag{}
+	flag.Var(headers, "http_header", "static upstream header as host=Name: value, may be repeated; use http_headers_file for credentials")
+	headersFile := flag.String("http_headers_file", "", "file with static upstream headers as host=Name: value lines")
+	adminAddr := flag.String("admin_addr", "127.0.0.1:8081", "address of the admin server with metrics, keep it private; empty disables it")
 	flag.Parse()
 
+	signatureKeys, err := loadKeys(*signatureKeysFile, signatureKeysEnv)
+	if err != nil {
+		log.Fatalf("can't load signature keys: %v", err)
+	}
+	thumborKeys, err := loadKeys(*thumborKeysFile, thumborKeysEnv)
+	if err != nil {
+		log.Fatalf("can't load thumbor keys: %v", err)
+	}
+	imgproxyKeys, err := loadImgproxyKeys(*imgproxyKeysFile, *imgproxySaltsFile)
+	if err != nil {
+		log.Fatalf("can't load imgproxy keys: %v", err)
+	}
+	if err := headers.readFile(*headersFile); err != nil {
+		log.Fatalf("can't load headers: %v", err)
+	}
+
 	cfg := app.Config{
 		ImageProvider: app.ImageProviderType(*imgProvider),
+		FileRoot:      *fileRoot,
+		Quality: app.QualityConfig{
+			Min:     *qualityMin,
+			Max:     *qualityMax,
+			Default: *qualityDefault,
+		},
+		Limits: app.LimitsConfig{
+			Source: app.DimensionLimits{
+				MaxWidth:      *sourceMaxWidth,
+				MaxHeight:     *sourceMaxHeight,
+				MaxMegapixels: *sourceMaxMegapixels,
+			},
+			Output: app.DimensionLimits{
+				MaxWidth:      *outputMaxWidth,
+				MaxHeight:     *outputMaxHeight,
+				MaxMegapixels: *outputMaxMegapixels,
+			},
+		},
+		Workers: app.WorkersConfig{
+			Count:     *workers,
+			QueueSize: *workerQueueSize,
+			QueueWait: *workerQueueWait,
+		},
+		PresetsFile:   *presetsFile,
+		PresetsOnly:   *presetsOnly,
+		SignatureKeys: signatureKeys,
+		ThumborKeys:   thumborKeys,
+		ImgproxyKeys:  imgproxyKeys,
+		HTTP: app.HTTPConfig{
+			MaxBodySize:           *maxBodySize,
+			DialTimeout:           *dialTimeout,
+			TLSHandshakeTimeout:   *tlsTimeout,
+			ResponseHeaderTimeout: *headerTimeout,
+			Timeout:               *totalTimeout,
+			MaxIdleConnsPerHost:   *maxIdleConns,
+			Retries:               *retries,
+			RetryBaseDelay:        *retryBaseDelay,
+			RetryMaxDelay:         *retryMaxDelay,
+			UserAgent:             *userAgent,
+			Headers:               headers,
+			AllowedHosts:          splitList(*allowedHosts),
+			DeniedNetworks:        splitList(*deniedNetworks),
+			MaxRedirects:          *maxRedirects,
+		},
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -43,6 +148,30 @@ func main() {
 		WriteTimeout: 10 * time.Second,
 	}
 
+	adminSrv := http.Server{
+		Addr:         *adminAddr,
+		Handler:      application.AdminHandler(),
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+	if *adminAddr != "" {
+		go func() {
+			if err := adminSrv.ListenAndServe(); err != http.ErrServerClosed {
+				logger.Error("admin server error", zap.Error(err))
+			}
+		}()
+	}
+
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, syscall.SIGHUP)
+		for range sig {
+			if err := application.ReloadPresets(); err != nil {
+				logger.Error("can't reload presets", zap.Error(err))
+			}
+		}
+	}()
+
 	shutdown := make(chan struct{})
 	go func(ctx context.Context) {
 		sig := make(chan os.Signal, 1)
@@ -57,6 +186,9 @@ func main() {
 		if err := srv.Shutdown(ctx); err != nil {
 			logger.Error("can't shut down server", zap.Error(err))
 		}
+		if err := adminSrv.Shutdown(ctx); err != nil {
+			logger.Error("can't shut down admin server", zap.Error(err))
+		}
 		close(shutdown)
 	}(ctx)
 
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/ivanovaleksey/resizer/pkg/signature"
+)
+
+const (
+	signatureKeysEnv = "RESIZER_SIGNATURE_KEYS"
+	thumborKeysEnv   = "RESIZER_THUMBOR_KEYS"
+	imgproxyKeysEnv  = "RESIZER_IMGPROXY_KEYS"
+	imgproxySaltsEnv = "RESIZER_IMGPROXY_SALTS"
+)
+
+// sign implements the "sign" subcommand which prints signed URLs:
+//
+//	RESIZER_SIGNATURE_KEYS=secret app sign '/image/resize?url=http://example.com/1.jpg&width=300'
+//
+// With -scheme it prints path scheme URLs with the signature segment instead,
+// signed the way thumbor or imgproxy sign them:
+//
+//	RESIZER_THUMBOR_KEYS=secret app sign -scheme thumbor '300x200/smart/http%3A%2F%2Fexample.com%2F1.jpg'
+func sign(args []string) int {
+	flags := flag.NewFlagSet("sign", flag.ContinueOnError)
+	keysFile := flags.String("keys_file", "", "file with comma or newline separated signing keys of the scheme, the first one signs; defaults to the environment variable of the scheme")
+	saltsFile := flags.String("salts_file", "", "file with hex encoded imgproxy salts; defaults to $"+imgproxySaltsEnv)
+	scheme := flags.String("scheme", "", "sign path scheme operations for thumbor or imgproxy, printed after their signature segment; defaults to query URLs signed with $"+signatureKeysEnv)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: app sign [-scheme thumbor|imgproxy] [-keys_file file] [-salts_file file] url...")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	signURL, err := urlSigner(*scheme, *keysFile, *saltsFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "can't create signer:", err)
+		return 1
+	}
+
+	for _, rawURL := range flags.Args() {
+		signed, err := signURL(rawURL)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "can't sign url:", err)
+			return 1
+		}
+		fmt.Println(signed)
+	}
+	return 0
+}
+
+// urlSigner returns the function signing URLs of the scheme.
+func urlSigner(scheme, keysFile, saltsFile string) (func(string) (string, error), error) {
+	switch scheme {
+	case "":
+		keys, err := loadKeys(keysFile, signatureKeysEnv)
+		if err != nil {
+			return nil, err
+		}
+		signer, err := signature.NewSigner(keys...)
+		if err != nil {
+			return nil, err
+		}
+		return signer.SignURL, nil
+	case "thumbor":
+		keys, err := loadKeys(keysFile, thumborKeysEnv)
+		if err != nil {
+			return nil, err
+		}
+		signer, err := signature.NewThumborSigner(keys...)
+		if err != nil {
+			return nil, err
+		}
+		return func(path string) (string, error) { return signer.SignPath(path) + "/" + path, nil }, nil
+	case "imgproxy":
+		keys, err := loadImgproxyKeys(keysFile, saltsFile)
+		if err != nil {
+			return nil, err
+		}
+		signer, err := signature.NewImgproxySigner(keys...)
+		if err != nil {
+			return nil, err
+		}
+		return func(path string) (string, error) { return signer.SignPath(path) + "/" + path, nil }, nil
+	default:
+		return nil, errors.Errorf("unknown scheme %q", scheme)
+	}
+}
+
+// loadKeys reads comma or newline separated keys from the file or from the environment variable.
+// Keys are never taken from flags, since the command line is visible to other processes.
+func loadKeys(file, env string) ([][]byte, error) {
+	value := os.Getenv(env)
+	if file != "" {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		value = strings.Replace(string(data), "\n", ",", -1)
+	}
+
+	var keys [][]byte
+	for _, key := range splitList(value) {
+		keys = append(keys, []byte(key))
+	}
+	return keys, nil
+}
+
+// loadImgproxyKeys reads hex encoded keys and salts, paired in order like imgproxy does.
+func loadImgproxyKeys(keysFile, saltsFile string) ([]signature.ImgproxyKey, error) {
+	keys, err := loadKeys(keysFile, imgproxyKeysEnv)
+	if err != nil {
+		return nil, err
+	}
+	salts, err := loadKeys(saltsFile, imgproxySaltsEnv)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) != len(salts) {
+		return nil, errors.Errorf("%d imgproxy keys don't match %d salts", len(keys), len(salts))
+	}
+
+	pairs := make([]signature.ImgproxyKey, len(keys))
+	for i := range keys {
+		if pairs[i].Key, err = hex.DecodeString(string(keys[i])); err != nil {
+			return nil, errors.Wrap(err, "invalid imgproxy key")
+		}
+		if pairs[i].Salt, err = hex.DecodeString(string(salts[i])); err != nil {
+			return nil, errors.Wrap(err, "invalid imgproxy salt")
+		}
+	}
+	return pairs, nil
+}
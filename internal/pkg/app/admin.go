@@ -0,0 +1,23 @@
+package app
+
+import (
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/ivanovaleksey/resizer/internal/pkg/resizer"
+)
+
+// ForgetImage forces a refetch of the url parameter, e.g. after the image is replaced upstream.
+// Cached results are keyed by the version of the source, so they change along with it.
+func (a *Application) ForgetImage(w http.ResponseWriter, r *http.Request) {
+	target := r.URL.Query().Get("url")
+	if target == "" {
+		a.writeError(w, resizer.ErrInvalidParams)
+		return
+	}
+
+	a.sources.Forget(target)
+	a.logger.Info("image forgotten", zap.String("url", target))
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -2,35 +2,50 @@ package app
 
 import (
 	"context"
-	"image"
+	"expvar"
 	"net/http"
 
 	"github.com/go-chi/chi"
-	"github.com/go-http-utils/etag"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
 
 	"github.com/ivanovaleksey/resizer/internal/pkg/cache"
 	"github.com/ivanovaleksey/resizer/internal/pkg/imagestore"
+	"github.com/ivanovaleksey/resizer/internal/pkg/preset"
 	"github.com/ivanovaleksey/resizer/internal/pkg/resizer"
 	"github.com/ivanovaleksey/resizer/internal/pkg/singleflight"
+	"github.com/ivanovaleksey/resizer/pkg/signature"
 )
 
 type Application struct {
+	config        Config
+	signer        *signature.Signer
+	thumbor       pathVerifier
+	imgproxy      pathVerifier
+	presets       *preset.Store
 	ctx           context.Context
 	logger        *zap.Logger
 	handler       http.Handler
+	adminHandler  http.Handler
 	resizeService Resizer
+	sources       Forgetter
 }
 
 type Resizer interface {
-	Resize(ctx context.Context, target string, params resizer.Params) (image.Image, error)
+	Resize(ctx context.Context, target string, params resizer.Params) (resizer.Result, error)
+	ETag(ctx context.Context, target string, params resizer.Params) (string, error)
+}
+
+// Forgetter drops cached sources, so they are fetched again.
+type Forgetter interface {
+	Forget(target string)
 }
 
 func NewApp(ctx context.Context, logger *zap.Logger) *Application {
 	return &Application{
-		ctx:    ctx,
-		logger: logger,
+		ctx:     ctx,
+		logger:  logger,
+		presets: preset.NewStore(),
 	}
 }
 
@@ -38,18 +53,65 @@ func (a *Application) Handler() http.Handler {
 	return a.handler
 }
 
+// AdminHandler serves metrics, it exposes process details and must not be public.
+func (a *Application) AdminHandler() http.Handler {
+	return a.adminHandler
+}
+
 func (a *Application) Init(cfg Config) error {
+	cfg.Quality = cfg.Quality.withDefaults()
+	cfg.Limits = cfg.Limits.withDefaults()
+	a.config = cfg
+
+	if len(cfg.SignatureKeys) > 0 {
+		signer, err := signature.NewSigner(cfg.SignatureKeys...)
+		if err != nil {
+			return errors.Wrap(err, "can't create signer")
+		}
+		a.signer = &signer
+	}
+	if len(cfg.ThumborKeys) > 0 {
+		signer, err := signature.NewThumborSigner(cfg.ThumborKeys...)
+		if err != nil {
+			return errors.Wrap(err, "can't create thumbor signer")
+		}
+		a.thumbor = signer
+	}
+	if len(cfg.ImgproxyKeys) > 0 {
+		signer, err := signature.NewImgproxySigner(cfg.ImgproxyKeys...)
+		if err != nil {
+			return errors.Wrap(err, "can't create imgproxy signer")
+		}
+		a.imgproxy = signer
+	}
+
+	if err := a.ReloadPresets(); err != nil {
+		return errors.Wrap(err, "can't load presets")
+	}
+
 	a.handler = chi.ServerBaseContext(a.ctx, a.initRouter())
+	a.adminHandler = a.initAdminRouter()
 
 	imageProvider, err := a.initImageProvider(cfg)
 	if err != nil {
 		return errors.Wrap(err, "can't create image provider")
 	}
+	a.sources = imageProvider
+
+	resultCache, err := cache.NewCache()
+	if err != nil {
+		return errors.Wrap(err, "can't create result cache")
+	}
 
 	opts := []resizer.ServiceOption{
 		resizer.WithLogger(a.logger),
+		resizer.WithResultCache(resultCache),
 		resizer.WithImageProvider(imageProvider),
+		resizer.WithImageDecoder(imagestore.NewDecoder(cfg.Limits.Source.limits())),
+		resizer.WithOutputLimits(cfg.Limits.Output.limits()),
+		resizer.WithWorkers(cfg.Workers.Count, cfg.Workers.QueueSize, cfg.Workers.QueueWait),
 		resizer.WithImageResizer(resizer.NewResizer()),
+		resizer.WithSmartResizer(resizer.NewSmartResizer()),
 	}
 	service, err := resizer.NewService(opts...)
 	if err != nil {
@@ -64,23 +126,45 @@ func (a *Application) initRouter() http.Handler {
 	r := chi.NewRouter()
 
 	r.Route("/image", func(r chi.Router) {
-		r.Get("/resize", etag.Handler(http.HandlerFunc(a.ResizeImage), false).ServeHTTP)
+		r.Use(a.verifySignature)
+		r.Get("/resize", a.ResizeImage)
+		r.Get("/preset/{name}", a.PresetImage)
 	})
+	r.Get(thumborPrefix+"*", a.pathHandler(thumborPrefix, a.thumbor, a.parseThumborParams))
+	r.Get(imgproxyPrefix+"*", a.pathHandler(imgproxyPrefix, a.imgproxy, a.parseImgproxyParams))
 
 	return r
 }
 
-func (a *Application) initImageProvider(cfg Config) (resizer.ImageProvider, error) {
-	imageCache, err := cache.NewCache()
+func (a *Application) initAdminRouter() http.Handler {
+	r := chi.NewRouter()
+	r.Handle("/debug/vars", expvar.Handler())
+	r.Post("/cache/forget", a.ForgetImage)
+	return r
+}
+
+func (a *Application) initImageProvider(cfg Config) (*singleflight.SingleFlight, error) {
+	// sources are cached as fetched, so the cache must hold the largest allowed body
+	imageCache, err := cache.NewCache(cache.WithMaxEntrySize(int(cfg.HTTP.MaxBodySize)))
 	if err != nil {
 		return nil, errors.Wrap(err, "can't create cache")
 	}
 	var imageProvider resizer.ImageProvider
 	switch cfg.ImageProvider {
 	case ImageProviderHTTP:
-		imageProvider = imagestore.NewHTTPStore()
+		opts, err := cfg.HTTP.options()
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid http config")
+		}
+		imageProvider = imagestore.NewHTTPStore(opts...)
 	case ImageProviderFile:
-		imageProvider = imagestore.NewFileStore()
+		if cfg.FileRoot == "" {
+			return nil, errors.New("file root is required")
+		}
+		imageProvider, err = imagestore.NewFileStore(cfg.FileRoot)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't create file store")
+		}
 	default:
 		return nil, errors.New("unknown image provider")
 	}
@@ -90,5 +174,9 @@ func (a *Application) initImageProvider(cfg Config) (resizer.ImageProvider, erro
 		singleflight.WithCacheProvider(imageCache),
 		singleflight.WithImageProvider(imageProvider),
 	}
+	if cfg.HTTP.Timeout > 0 {
+		// the shared fetch must not be cut before the upstream one
+		opts = append(opts, singleflight.WithTimeout(cfg.HTTP.Timeout))
+	}
 	return singleflight.NewSingleFlight(opts...), nil
 }
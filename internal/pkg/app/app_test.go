@@ -0,0 +1,75 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/disintegration/imaging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/ivanovaleksey/resizer/test"
+)
+
+func TestApplication_AdminHandler(t *testing.T) {
+	app := NewApp(context.Background(), zap.NewNop())
+	require.NoError(t, app.Init(Config{ImageProvider: ImageProviderFile, FileRoot: test.RootDir(t, 3)}))
+
+	// metrics include the command line, they must not be public
+	rr := httptest.NewRecorder()
+	app.Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/debug/vars", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	rr = httptest.NewRecorder()
+	app.AdminHandler().ServeHTTP(rr, httptest.NewRequest("GET", "/debug/vars", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"resizer"`)
+}
+
+func TestApplication_ForgetImage(t *testing.T) {
+	root, err := ioutil.TempDir("", "resizer")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	writeImage := func(c color.Color) {
+		buf := &bytes.Buffer{}
+		require.NoError(t, png.Encode(buf, imaging.New(100, 100, c)))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(root, "1.png"), buf.Bytes(), 0644))
+	}
+	servedColor := func(app *Application) color.NRGBA {
+		rr := httptest.NewRecorder()
+		app.Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/image/resize?url=1.png&width=50&format=png", nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		img, err := png.Decode(rr.Body)
+		require.NoError(t, err)
+		return imaging.Clone(img).NRGBAAt(25, 25)
+	}
+
+	app := NewApp(context.Background(), zap.NewNop())
+	require.NoError(t, app.Init(Config{ImageProvider: ImageProviderFile, FileRoot: root}))
+
+	red := color.NRGBA{R: 255, A: 255}
+	blue := color.NRGBA{B: 255, A: 255}
+
+	writeImage(red)
+	assert.Equal(t, red, servedColor(app))
+
+	// the source is cached until it is forgotten
+	writeImage(blue)
+	assert.Equal(t, red, servedColor(app))
+
+	rr := httptest.NewRecorder()
+	app.AdminHandler().ServeHTTP(rr, httptest.NewRequest("POST", "/cache/forget?url=1.png", nil))
+	require.Equal(t, http.StatusNoContent, rr.Code)
+	assert.Equal(t, blue, servedColor(app))
+}
@@ -1,5 +1,14 @@
 package app
 
+import (
+	"net/http"
+	"time"
+
+	"github.com/ivanovaleksey/resizer/internal/pkg/imagestore"
+	"github.com/ivanovaleksey/resizer/internal/pkg/resizer"
+	"github.com/ivanovaleksey/resizer/pkg/signature"
+)
+
 type ImageProviderType int
 
 const (
@@ -9,4 +18,192 @@ const (
 
 type Config struct {
 	ImageProvider ImageProviderType // 1 - http, 2 - file
+	FileRoot      string            // directory the file provider serves from
+	Quality       QualityConfig
+	HTTP          HTTPConfig
+	Limits        LimitsConfig
+	Workers       WorkersConfig
+
+	// PresetsFile is a YAML or JSON file with named presets, it is reloaded by ReloadPresets.
+	PresetsFile string
+	// PresetsOnly rejects requests which don't use a preset, bounding the cache keyspace.
+	PresetsOnly bool
+
+	// SignatureKeys enables request signing when not empty.
+	// The first key is the current one, the others are accepted during rotation.
+	SignatureKeys [][]byte
+
+	// ThumborKeys and ImgproxyKeys sign the path schemes the way thumbor and imgproxy do,
+	// so URLs built by their client libraries are accepted. A scheme without keys
+	// is unsigned, unless SignatureKeys are set, then it is refused.
+	ThumborKeys  [][]byte
+	ImgproxyKeys []signature.ImgproxyKey
+}
+
+// HTTPConfig configures the HTTP image provider, zero values keep the imagestore defaults.
+type HTTPConfig struct {
+	MaxBodySize int64 // in bytes
+
+	DialTimeout           time.Duration
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration
+	Timeout               time.Duration // total, including retries
+	MaxIdleConnsPerHost   int
+
+	Retries        int // negative disables retries
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+
+	UserAgent string
+	Headers   map[string]http.Header // static headers by upstream host
+
+	AllowedHosts   []string // glob patterns, empty allows any host
+	DeniedNetworks []string // CIDRs, nil means imagestore.DefaultDeniedNetworks
+	MaxRedirects   int      // negative disables redirects
+}
+
+func (c HTTPConfig) options() ([]imagestore.HTTPOption, error) {
+	var opts []imagestore.HTTPOption
+	if c.MaxBodySize > 0 {
+		opts = append(opts, imagestore.WithMaxBodySize(c.MaxBodySize))
+	}
+	if c.DialTimeout > 0 {
+		opts = append(opts, imagestore.WithDialTimeout(c.DialTimeout))
+	}
+	if c.TLSHandshakeTimeout > 0 {
+		opts = append(opts, imagestore.WithTLSHandshakeTimeout(c.TLSHandshakeTimeout))
+	}
+	if c.ResponseHeaderTimeout > 0 {
+		opts = append(opts, imagestore.WithResponseHeaderTimeout(c.ResponseHeaderTimeout))
+	}
+	if c.Timeout > 0 {
+		opts = append(opts, imagestore.WithTimeout(c.Timeout))
+	}
+	if c.MaxIdleConnsPerHost > 0 {
+		opts = append(opts, imagestore.WithMaxIdleConnsPerHost(c.MaxIdleConnsPerHost))
+	}
+	if c.Retries < 0 {
+		opts = append(opts, imagestore.WithRetries(0))
+	} else if c.Retries > 0 {
+		opts = append(opts, imagestore.WithRetries(c.Retries))
+	}
+	if c.RetryBaseDelay > 0 && c.RetryMaxDelay > 0 {
+		opts = append(opts, imagestore.WithRetryDelay(c.RetryBaseDelay, c.RetryMaxDelay))
+	}
+	if c.UserAgent != "" {
+		opts = append(opts, imagestore.WithUserAgent(c.UserAgent))
+	}
+	for host, header := range c.Headers {
+		opts = append(opts, imagestore.WithOriginHeaders(host, header))
+	}
+	if len(c.AllowedHosts) > 0 {
+		opts = append(opts, imagestore.WithAllowedHosts(c.AllowedHosts...))
+	}
+	if c.DeniedNetworks != nil {
+		networks, err := imagestore.ParseNetworks(c.DeniedNetworks)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, imagestore.WithDeniedNetworks(networks...))
+	}
+	if c.MaxRedirects < 0 {
+		opts = append(opts, imagestore.WithMaxRedirects(0))
+	} else if c.MaxRedirects > 0 {
+		opts = append(opts, imagestore.WithMaxRedirects(c.MaxRedirects))
+	}
+	return opts, nil
+}
+
+// LimitsConfig bounds image dimensions to keep decompression bombs
+// and huge outputs from exhausting memory.
+type LimitsConfig struct {
+	Source DimensionLimits // checked before decoding
+	Output DimensionLimits // checked against requested dimensions
+}
+
+// DimensionLimits are zero for the defaults and negative for no limit.
+type DimensionLimits struct {
+	MaxWidth      int
+	MaxHeight     int
+	MaxMegapixels float64
+}
+
+func (c LimitsConfig) withDefaults() LimitsConfig {
+	c.Source = c.Source.withDefaults(DimensionLimits{MaxWidth: 16384, MaxHeight: 16384, MaxMegapixels: 50})
+	c.Output = c.Output.withDefaults(DimensionLimits{MaxWidth: 8192, MaxHeight: 8192, MaxMegapixels: 40})
+	return c
+}
+
+func (c DimensionLimits) withDefaults(defaults DimensionLimits) DimensionLimits {
+	if c.MaxWidth == 0 {
+		c.MaxWidth = defaults.MaxWidth
+	}
+	if c.MaxHeight == 0 {
+		c.MaxHeight = defaults.MaxHeight
+	}
+	if c.MaxMegapixels == 0 {
+		c.MaxMegapixels = defaults.MaxMegapixels
+	}
+	return c
+}
+
+func (c DimensionLimits) limits() imagestore.Limits {
+	var l imagestore.Limits
+	if c.MaxWidth > 0 {
+		l.MaxWidth = c.MaxWidth
+	}
+	if c.MaxHeight > 0 {
+		l.MaxHeight = c.MaxHeight
+	}
+	if c.MaxMegapixels > 0 {
+		l.MaxPixels = int64(c.MaxMegapixels * 1e6)
+	}
+	return l
+}
+
+// WorkersConfig bounds concurrent image processing, zero values keep the resizer defaults.
+type WorkersConfig struct {
+	Count     int           // GOMAXPROCS by default
+	QueueSize int           // requests waiting for a worker, negative disables the queue
+	QueueWait time.Duration // maximal wait for a worker
+}
+
+// retryAfter is the number of seconds overloaded clients are asked to wait, at least a second.
+func (c WorkersConfig) retryAfter() int {
+	wait := c.QueueWait
+	if wait <= 0 {
+		wait = resizer.DefaultQueueWait
+	}
+	return int((wait + time.Second - 1) / time.Second)
+}
+
+// QualityConfig bounds the JPEG quality clients may request.
+type QualityConfig struct {
+	Min     int
+	Max     int
+	Default int // used when the request has no quality
+}
+
+func (c QualityConfig) withDefaults() QualityConfig {
+	if c.Min <= 0 {
+		c.Min = 1
+	}
+	if c.Max <= 0 || c.Max > 100 {
+		c.Max = 100
+	}
+	if c.Default <= 0 {
+		c.Default = 75
+	}
+	c.Default = clampInt(c.Default, c.Min, c.Max)
+	return c
+}
+
+func clampInt(x, min, max int) int {
+	if x < min {
+		return min
+	}
+	if x > max {
+		return max
+	}
+	return x
 }
@@ -0,0 +1,95 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/ivanovaleksey/resizer/internal/pkg/imagestore"
+	"github.com/ivanovaleksey/resizer/internal/pkg/resizer"
+	"github.com/ivanovaleksey/resizer/pkg/signature"
+)
+
+// StatusClientClosedRequest is a non-standard status for requests cancelled by the client.
+const StatusClientClosedRequest = 499
+
+type errorResponse struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// errorStatus maps the cause of err onto the HTTP status and a stable error code.
+func errorStatus(err error) (int, string) {
+	cause := errors.Cause(err)
+	if urlErr, ok := cause.(*url.Error); ok {
+		cause = urlErr.Err
+	}
+
+	if statusErr, ok := cause.(*imagestore.StatusError); ok {
+		if statusErr.NotFound() {
+			return http.StatusNotFound, "not_found"
+		}
+		return http.StatusBadGateway, "bad_upstream"
+	}
+
+	switch cause {
+	case context.Canceled:
+		return StatusClientClosedRequest, "canceled"
+	case context.DeadlineExceeded:
+		return http.StatusGatewayTimeout, "timeout"
+	case imagestore.ErrNotFound:
+		return http.StatusNotFound, "not_found"
+	case imagestore.ErrUnsupportedFormat, imagestore.ErrCorruptedImage:
+		return http.StatusUnsupportedMediaType, "unsupported_media_type"
+	case signature.ErrMissing, signature.ErrInvalid:
+		return http.StatusForbidden, "invalid_signature"
+	case imagestore.ErrForbidden, imagestore.ErrTooManyRedirects:
+		return http.StatusForbidden, "forbidden"
+	case imagestore.ErrInvalidURL:
+		return http.StatusBadRequest, "invalid_url"
+	case imagestore.ErrTooLarge, imagestore.ErrDimensionsExceeded:
+		return http.StatusUnprocessableEntity, "too_large"
+	case resizer.ErrInvalidParams:
+		return http.StatusBadRequest, "invalid_params"
+	case resizer.ErrOverloaded:
+		return http.StatusServiceUnavailable, "overloaded"
+	}
+
+	if t, ok := cause.(interface{ Timeout() bool }); ok && t.Timeout() {
+		return http.StatusGatewayTimeout, "timeout"
+	}
+
+	return http.StatusInternalServerError, "internal"
+}
+
+// writeError responds with a JSON error, details of internal errors are only logged.
+func (a *Application) writeError(w http.ResponseWriter, err error) {
+	status, code := errorStatus(err)
+
+	message := err.Error()
+	if status >= http.StatusInternalServerError {
+		a.logger.Error("request failed", zap.Error(err), zap.Int("status", status))
+		message = http.StatusText(status)
+	} else {
+		a.logger.Info("request rejected", zap.Error(err), zap.Int("status", status))
+	}
+
+	body, _ := json.Marshal(errorResponse{Status: status, Code: code, Message: message})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if status == http.StatusServiceUnavailable {
+		w.Header().Set("Retry-After", strconv.Itoa(a.config.Workers.retryAfter()))
+	}
+	w.WriteHeader(status)
+	if _, err := w.Write(body); err != nil {
+		a.logger.Error("can't write response", zap.Error(err))
+	}
+}
@@ -0,0 +1,69 @@
+package app
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/ivanovaleksey/resizer/internal/pkg/imagestore"
+	"github.com/ivanovaleksey/resizer/internal/pkg/resizer"
+)
+
+func TestErrorStatus(t *testing.T) {
+	timeout := &net.OpError{Op: "dial", Err: timeoutError{}}
+
+	cases := []struct {
+		name     string
+		err      error
+		expected int
+	}{
+		{"not found", errors.Wrap(imagestore.ErrNotFound, "http://example.com/1.jpg"), http.StatusNotFound},
+		{"upstream not found", errors.Wrap(&imagestore.StatusError{StatusCode: 404}, "can't get image"), http.StatusNotFound},
+		{"upstream failure", errors.Wrap(&imagestore.StatusError{StatusCode: 503}, "can't get image"), http.StatusBadGateway},
+		{"too large", errors.Wrap(imagestore.ErrTooLarge, "http://example.com/1.jpg"), http.StatusUnprocessableEntity},
+		{"dimensions exceeded", errors.Wrap(imagestore.ErrDimensionsExceeded, "width 20000 exceeds 16384"), http.StatusUnprocessableEntity},
+		{"forbidden", errors.Wrap(imagestore.ErrForbidden, "address 127.0.0.1 is denied"), http.StatusForbidden},
+		{"not image", errors.Wrap(imagestore.ErrUnsupportedFormat, "text/html"), http.StatusUnsupportedMediaType},
+		{"invalid params", errors.Wrap(resizer.ErrInvalidParams, "negative width"), http.StatusBadRequest},
+		{"overloaded", errors.Wrap(resizer.ErrOverloaded, "can't resize image"), http.StatusServiceUnavailable},
+		{"deadline", errors.Wrap(context.DeadlineExceeded, "can't resize image"), http.StatusGatewayTimeout},
+		{"network timeout", errors.Wrap(&url.Error{Op: "Get", Err: timeout}, "can't get image"), http.StatusGatewayTimeout},
+		{"canceled", errors.Wrap(&url.Error{Op: "Get", Err: context.Canceled}, "can't get image"), StatusClientClosedRequest},
+		{"unknown", errors.New("boom"), http.StatusInternalServerError},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			status, _ := errorStatus(tc.err)
+			assert.Equal(t, tc.expected, status)
+		})
+	}
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestWriteError(t *testing.T) {
+	t.Run("it asks overloaded clients to retry", func(t *testing.T) {
+		a := NewApp(context.Background(), zap.NewNop())
+		a.config.Workers.QueueWait = 1500 * time.Millisecond
+
+		w := httptest.NewRecorder()
+		a.writeError(w, errors.Wrap(resizer.ErrOverloaded, "can't resize image"))
+
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Equal(t, "2", w.Header().Get("Retry-After"))
+		assert.Contains(t, w.Body.String(), `"code":"overloaded"`)
+	})
+}
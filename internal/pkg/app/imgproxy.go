@@ -0,0 +1,202 @@
+package app
+
+import (
+	"encoding/base64"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/ivanovaleksey/resizer/internal/pkg/resizer"
+)
+
+var imgproxyModes = map[string]resizer.Mode{
+	"fit":   resizer.ModeFit,
+	"fill":  resizer.ModeFill,
+	"force": resizer.ModeStretch,
+	"auto":  resizer.ModeFill,
+}
+
+var imgproxyGravity = map[string]resizer.Gravity{
+	"ce":   resizer.GravityCenter,
+	"no":   resizer.GravityNorth,
+	"so":   resizer.GravitySouth,
+	"ea":   resizer.GravityEast,
+	"we":   resizer.GravityWest,
+	"noea": resizer.GravityNorthEast,
+	"nowe": resizer.GravityNorthWest,
+	"soea": resizer.GravitySouthEast,
+	"sowe": resizer.GravitySouthWest,
+	"sm":   resizer.GravitySmart,
+	"fp":   resizer.GravityFocalPoint,
+}
+
+// parseImgproxyParams parses imgproxy style paths:
+//
+//	[option:arg:.../...]plain/image[@extension]
+//	[option:arg:.../...]base64url-image[.extension]
+//
+// Supported options are rs (resize), rt (resizing_type), s (size), w (width),
+// h (height), g (gravity), q (quality) and f (format). Unknown options, enlarging,
+// extending and gravity offsets are rejected, so results never silently differ
+// from the ones of imgproxy.
+func (a *Application) parseImgproxyParams(path string) (string, resizer.Params, error) {
+	params := resizer.Params{
+		Mode:    resizer.ModeFit,
+		Gravity: resizer.GravityCenter,
+	}
+	params.Encoding.Quality = a.config.Quality.Default
+
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if segment == "plain" {
+			return plainImgproxySource(strings.Join(segments[i+1:], "/"), params)
+		}
+		if !strings.Contains(segment, ":") {
+			return encodedImgproxySource(strings.Join(segments[i:], ""), params)
+		}
+
+		args := strings.Split(segment, ":")
+		if err := a.applyImgproxyOption(&params, args[0], args[1:]); err != nil {
+			return "", params, err
+		}
+	}
+	return "", params, errors.Wrap(resizer.ErrInvalidParams, "missing image")
+}
+
+func (a *Application) applyImgproxyOption(params *resizer.Params, name string, args []string) error {
+	arg := func(i int) string {
+		if i < len(args) {
+			return args[i]
+		}
+		return ""
+	}
+
+	var err error
+	switch name {
+	case "rs", "resize":
+		if unsupportedArgs(args, 3) {
+			return errors.Wrap(resizer.ErrInvalidParams, "enlarge and extend are not supported")
+		}
+		if err := applyImgproxyMode(params, arg(0)); err != nil {
+			return err
+		}
+		return applyImgproxySize(params, arg(1), arg(2))
+	case "rt", "resizing_type":
+		return applyImgproxyMode(params, arg(0))
+	case "s", "size":
+		if unsupportedArgs(args, 2) {
+			return errors.Wrap(resizer.ErrInvalidParams, "enlarge and extend are not supported")
+		}
+		return applyImgproxySize(params, arg(0), arg(1))
+	case "w", "width":
+		if params.Width, err = parseDimension(arg(0)); err != nil {
+			return invalidParam("width")
+		}
+	case "h", "height":
+		if params.Height, err = parseDimension(arg(0)); err != nil {
+			return invalidParam("height")
+		}
+	case "g", "gravity":
+		gravity, ok := imgproxyGravity[arg(0)]
+		if !ok {
+			return invalidParam("gravity")
+		}
+		params.Gravity = gravity
+		if gravity != resizer.GravityFocalPoint {
+			if unsupportedArgs(args, 1) {
+				return errors.Wrap(resizer.ErrInvalidParams, "gravity offsets are not supported")
+			}
+			return nil
+		}
+		if unsupportedArgs(args, 3) {
+			return invalidParam("gravity")
+		}
+		if params.FocalPoint.X, err = strconv.ParseFloat(arg(1), 64); err != nil {
+			return invalidParam("focal point x")
+		}
+		if params.FocalPoint.Y, err = strconv.ParseFloat(arg(2), 64); err != nil {
+			return invalidParam("focal point y")
+		}
+	case "q", "quality":
+		if params.Encoding.Quality, err = a.parseQuality(arg(0)); err != nil {
+			return err
+		}
+	case "f", "format", "ext":
+		params.Format = parseFormat(arg(0))
+	default:
+		return errors.Wrapf(resizer.ErrInvalidParams, "unknown option %q", name)
+	}
+	return nil
+}
+
+// unsupportedArgs reports whether any argument starting from i differs from its default,
+// imgproxy takes empty, zero and false values as defaults.
+func unsupportedArgs(args []string, i int) bool {
+	for ; i < len(args); i++ {
+		switch args[i] {
+		case "", "0", "f", "false":
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+func applyImgproxyMode(params *resizer.Params, value string) error {
+	if value == "" {
+		return nil
+	}
+	mode, ok := imgproxyModes[value]
+	if !ok {
+		return invalidParam("resizing type")
+	}
+	params.Mode = mode
+	return nil
+}
+
+func applyImgproxySize(params *resizer.Params, width, height string) error {
+	var err error
+	if params.Width, err = parseDimension(width); err != nil {
+		return invalidParam("width")
+	}
+	if params.Height, err = parseDimension(height); err != nil {
+		return invalidParam("height")
+	}
+	return nil
+}
+
+// plainImgproxySource parses a URL encoded image with an optional @extension.
+func plainImgproxySource(source string, params resizer.Params) (string, resizer.Params, error) {
+	if i := strings.LastIndexByte(source, '@'); i >= 0 {
+		source, params.Format = source[:i], parseFormat(source[i+1:])
+	}
+	imageURL, err := url.PathUnescape(source)
+	if err != nil {
+		return "", params, invalidParam("image")
+	}
+	return validImgproxySource(imageURL, params)
+}
+
+// encodedImgproxySource parses a base64url encoded image with an optional .extension.
+func encodedImgproxySource(source string, params resizer.Params) (string, resizer.Params, error) {
+	if i := strings.LastIndexByte(source, '.'); i >= 0 {
+		source, params.Format = source[:i], parseFormat(source[i+1:])
+	}
+	imageURL, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(source, "="))
+	if err != nil {
+		return "", params, invalidParam("image")
+	}
+	return validImgproxySource(string(imageURL), params)
+}
+
+func validImgproxySource(imageURL string, params resizer.Params) (string, resizer.Params, error) {
+	if imageURL == "" {
+		return "", params, errors.Wrap(resizer.ErrInvalidParams, "missing image")
+	}
+	if err := params.Validate(); err != nil {
+		return "", params, err
+	}
+	return imageURL, params, nil
+}
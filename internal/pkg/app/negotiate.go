@@ -0,0 +1,63 @@
+package app
+
+import (
+	"mime"
+	"strconv"
+	"strings"
+
+	"github.com/ivanovaleksey/resizer/internal/pkg/encoder"
+	"github.com/ivanovaleksey/resizer/internal/pkg/format"
+)
+
+// outputFormats lists the formats which may be picked in auto mode.
+var outputFormats = []format.Format{format.WebP, format.JPEG, format.PNG, format.GIF}
+
+// acceptedFormats returns the supported output formats allowed by the Accept header.
+func acceptedFormats(accept string) []format.Format {
+	var accepted []format.Format
+	for _, f := range outputFormats {
+		if encoder.Supported(f) && accepts(accept, f.ContentType()) {
+			accepted = append(accepted, f)
+		}
+	}
+	return accepted
+}
+
+// accepts reports whether the Accept header allows the content type.
+// The most specific media range decides, missing header allows everything.
+func accepts(accept, contentType string) bool {
+	if strings.TrimSpace(accept) == "" {
+		return true
+	}
+
+	specificity, quality := -1, 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		var s int
+		switch mediaType {
+		case contentType:
+			s = 2
+		case "image/*":
+			s = 1
+		case "*/*":
+			s = 0
+		default:
+			continue
+		}
+		if s < specificity {
+			continue
+		}
+
+		q := 1.0
+		if v, err := strconv.ParseFloat(params["q"], 64); err == nil {
+			q = v
+		}
+		specificity, quality = s, q
+	}
+
+	return quality > 0
+}
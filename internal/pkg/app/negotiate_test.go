@@ -0,0 +1,32 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ivanovaleksey/resizer/internal/pkg/encoder"
+	"github.com/ivanovaleksey/resizer/internal/pkg/format"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	cases := []struct {
+		name     string
+		accept   string
+		hasAlpha bool
+		expected format.Format
+	}{
+		{"no accept header", "", false, format.JPEG},
+		{"no accept header with alpha", "", true, format.PNG},
+		{"browser", "image/webp,image/apng,image/*,*/*;q=0.8", true, format.PNG},
+		{"only gif with alpha", "image/gif", true, format.GIF},
+		{"png excluded", "image/*,image/png;q=0", true, format.GIF},
+		{"nothing acceptable", "text/html", false, format.JPEG},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, encoder.Negotiate(acceptedFormats(tc.accept), tc.hasAlpha))
+		})
+	}
+}
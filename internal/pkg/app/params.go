@@ -0,0 +1,138 @@
+package app
+
+import (
+	"net/url"
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	"github.com/ivanovaleksey/resizer/internal/pkg/encoder"
+	"github.com/ivanovaleksey/resizer/internal/pkg/format"
+	"github.com/ivanovaleksey/resizer/internal/pkg/resizer"
+)
+
+const (
+	widthParamName       = "width"
+	heightParamName      = "height"
+	modeParamName        = "mode"
+	gravityParamName     = "gravity"
+	focalPointXParamName = "fp-x"
+	focalPointYParamName = "fp-y"
+	formatParamName      = "format"
+	qualityParamName     = "quality"
+	compressionParamName = "compression"
+	opsParamName         = "ops"
+	metadataParamName    = "metadata"
+
+	autoFormat = "auto"
+
+	keepMetadata  = "keep"
+	stripMetadata = "strip"
+)
+
+func (a *Application) parseParams(query url.Values) (resizer.Params, error) {
+	var (
+		params resizer.Params
+		err    error
+	)
+
+	params.Width, err = parseDimension(query.Get(widthParamName))
+	if err != nil {
+		return params, invalidParam("width")
+	}
+
+	params.Height, err = parseDimension(query.Get(heightParamName))
+	if err != nil {
+		return params, invalidParam("height")
+	}
+
+	params.Mode, err = resizer.ParseMode(query.Get(modeParamName))
+	if err != nil {
+		return params, invalidParam("mode")
+	}
+
+	gravity := query.Get(gravityParamName)
+	params.Gravity, err = resizer.ParseGravity(gravity)
+	if err != nil {
+		return params, invalidParam("gravity")
+	}
+
+	fpX, fpY := query.Get(focalPointXParamName), query.Get(focalPointYParamName)
+	if fpX != "" || fpY != "" {
+		if gravity != "" && params.Gravity != resizer.GravityFocalPoint {
+			return params, errors.Wrap(resizer.ErrInvalidParams, "focal point conflicts with gravity")
+		}
+		params.Gravity = resizer.GravityFocalPoint
+	}
+	if params.Gravity == resizer.GravityFocalPoint {
+		params.FocalPoint = resizer.FocalPoint{X: 0.5, Y: 0.5}
+	}
+	if fpX != "" {
+		params.FocalPoint.X, err = strconv.ParseFloat(fpX, 64)
+		if err != nil {
+			return params, invalidParam("focal point x")
+		}
+	}
+	if fpY != "" {
+		params.FocalPoint.Y, err = strconv.ParseFloat(fpY, 64)
+		if err != nil {
+			return params, invalidParam("focal point y")
+		}
+	}
+	if f := query.Get(formatParamName); f != autoFormat {
+		params.Format = format.Format(f)
+	}
+
+	params.Encoding.Quality, err = a.parseQuality(query.Get(qualityParamName))
+	if err != nil {
+		return params, err
+	}
+
+	params.Encoding.Compression, err = encoder.ParseCompression(query.Get(compressionParamName))
+	if err != nil {
+		return params, invalidParam("compression")
+	}
+
+	params.Ops, err = resizer.ParsePipeline(query.Get(opsParamName))
+	if err != nil {
+		return params, err
+	}
+
+	switch query.Get(metadataParamName) {
+	case "", stripMetadata:
+	case keepMetadata:
+		params.KeepMetadata = true
+	default:
+		return params, invalidParam("metadata")
+	}
+
+	if err := params.Validate(); err != nil {
+		return params, err
+	}
+
+	return params, nil
+}
+
+// parseQuality clamps the quality to the configured range, an empty value means the default one.
+func (a *Application) parseQuality(value string) (int, error) {
+	if value == "" {
+		return a.config.Quality.Default, nil
+	}
+	quality, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, invalidParam("quality")
+	}
+	return clampInt(quality, a.config.Quality.Min, a.config.Quality.Max), nil
+}
+
+func invalidParam(name string) error {
+	return errors.Wrapf(resizer.ErrInvalidParams, "invalid %s", name)
+}
+
+// parseDimension treats a missing value as zero, so it is derived from the aspect ratio.
+func parseDimension(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(value)
+}
@@ -0,0 +1,86 @@
+package app
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/ivanovaleksey/resizer/internal/pkg/format"
+	"github.com/ivanovaleksey/resizer/internal/pkg/resizer"
+	"github.com/ivanovaleksey/resizer/pkg/signature"
+)
+
+const (
+	thumborPrefix  = "/thumbor/"
+	imgproxyPrefix = "/imgproxy/"
+)
+
+// unsignedSegments are the placeholders path schemes put instead of a signature.
+var unsignedSegments = map[string]bool{
+	"unsafe":   true,
+	"insecure": true,
+}
+
+// pathVerifier checks the signature segment of a path scheme against the rest of the escaped path.
+type pathVerifier interface {
+	VerifyPath(path, signature string) error
+}
+
+// pathParser returns the image URL and params encoded in the path following the signature segment.
+type pathParser func(path string) (string, resizer.Params, error)
+
+// pathHandler serves a path-based URL scheme. Operations are encoded in the path,
+// so they survive CDNs stripping query strings. The first segment after the prefix
+// is the signature of the rest of the escaped path or a placeholder when signing is disabled.
+func (a *Application) pathHandler(prefix string, verifier pathVerifier, parse pathParser) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if a.config.PresetsOnly {
+			a.writeError(w, errors.Wrap(resizer.ErrInvalidParams, "only presets are allowed"))
+			return
+		}
+
+		path := strings.TrimPrefix(r.URL.EscapedPath(), prefix)
+		i := strings.IndexByte(path, '/')
+		if i < 0 {
+			a.writeError(w, errors.Wrap(resizer.ErrInvalidParams, "missing image"))
+			return
+		}
+
+		if err := a.verifyPathSignature(verifier, path[i+1:], path[:i]); err != nil {
+			a.writeError(w, err)
+			return
+		}
+
+		imageURL, params, err := parse(path[i+1:])
+		if err != nil {
+			a.writeError(w, err)
+			return
+		}
+
+		a.serveImage(w, r, imageURL, params)
+	}
+}
+
+// verifyPathSignature checks the signature with the keys of the scheme.
+// Once request signing is enabled, a scheme without keys can't be used unsigned.
+func (a *Application) verifyPathSignature(verifier pathVerifier, path, segment string) error {
+	if verifier == nil {
+		if a.signer != nil {
+			return errors.Wrap(signature.ErrMissing, "no signing keys of the scheme")
+		}
+		return nil
+	}
+	if unsignedSegments[segment] {
+		return signature.ErrMissing
+	}
+	return verifier.VerifyPath(path, segment)
+}
+
+// parseFormat accepts the extensions path schemes use for formats.
+func parseFormat(s string) format.Format {
+	if s == "jpg" {
+		return format.JPEG
+	}
+	return format.Format(s)
+}
@@ -0,0 +1,131 @@
+package app
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ivanovaleksey/resizer/internal/pkg/format"
+	"github.com/ivanovaleksey/resizer/internal/pkg/resizer"
+)
+
+func TestApplication_parseThumborParams(t *testing.T) {
+	app := &Application{config: Config{Quality: QualityConfig{}.withDefaults()}}
+
+	cases := []struct {
+		path    string
+		image   string
+		params  resizer.Params
+		quality int
+	}{
+		{
+			"300x200/http%3A%2F%2Fexample.com%2F1.jpg",
+			"http://example.com/1.jpg",
+			resizer.Params{Width: 300, Height: 200, Mode: resizer.ModeFill, Gravity: resizer.GravityCenter},
+			75,
+		},
+		{
+			"fit-in/300x0/example.com/images/1.jpg",
+			"example.com/images/1.jpg",
+			resizer.Params{Width: 300, Mode: resizer.ModeFit, Gravity: resizer.GravityCenter},
+			75,
+		},
+		{
+			"x200/left/top/example.com/1.jpg",
+			"example.com/1.jpg",
+			resizer.Params{Height: 200, Mode: resizer.ModeStretch, Gravity: resizer.GravityNorthWest},
+			75,
+		},
+		{
+			"300x200/smart/filters:quality(80):format(png):strip_icc()/example.com/1.jpg",
+			"example.com/1.jpg",
+			resizer.Params{Width: 300, Height: 200, Mode: resizer.ModeFill, Gravity: resizer.GravitySmart, Format: format.PNG},
+			80,
+		},
+	}
+
+	for _, tc := range cases {
+		image, params, err := app.parseThumborParams(tc.path)
+		require.NoError(t, err, tc.path)
+		assert.Equal(t, tc.image, image, tc.path)
+
+		assert.Equal(t, tc.quality, params.Encoding.Quality, tc.path)
+		params.Encoding = tc.params.Encoding
+		assert.Equal(t, tc.params, params, tc.path)
+	}
+
+	for _, path := range []string{
+		"300x200/",
+		"trim/300x200/example.com/1.jpg",
+		"10x10:290x190/300x200/example.com/1.jpg",
+		"-300x200/example.com/1.jpg",
+		"example.com/1.jpg",
+		"300x200/filters:quality(high)/example.com/1.jpg",
+		"300x200/filters:blur(2)/example.com/1.jpg",
+		"meta/300x200/example.com/1.jpg",
+	} {
+		_, _, err := app.parseThumborParams(path)
+		assert.Equal(t, resizer.ErrInvalidParams, errors.Cause(err), path)
+	}
+}
+
+func TestApplication_parseImgproxyParams(t *testing.T) {
+	app := &Application{config: Config{Quality: QualityConfig{}.withDefaults()}}
+	encoded := base64.RawURLEncoding.EncodeToString([]byte("http://example.com/images/1.jpg"))
+
+	cases := []struct {
+		path   string
+		params resizer.Params
+	}{
+		{
+			"rs:fill:300:200:0/g:sm/" + encoded,
+			resizer.Params{Width: 300, Height: 200, Mode: resizer.ModeFill, Gravity: resizer.GravitySmart},
+		},
+		{
+			"s:300:200:false/g:no:0:0/" + encoded,
+			resizer.Params{Width: 300, Height: 200, Mode: resizer.ModeFit, Gravity: resizer.GravityNorth},
+		},
+		{
+			"w:300/" + encoded[:10] + "/" + encoded[10:] + ".png",
+			resizer.Params{Width: 300, Mode: resizer.ModeFit, Gravity: resizer.GravityCenter, Format: format.PNG},
+		},
+		{
+			"rt:force/s:300:200/g:fp:0.2:0.8/q:90/plain/http%3A%2F%2Fexample.com%2Fimages%2F1.jpg@gif",
+			resizer.Params{
+				Width: 300, Height: 200, Mode: resizer.ModeStretch,
+				Gravity: resizer.GravityFocalPoint, FocalPoint: resizer.FocalPoint{X: 0.2, Y: 0.8},
+				Format: format.GIF,
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		image, params, err := app.parseImgproxyParams(tc.path)
+		require.NoError(t, err, tc.path)
+		assert.Equal(t, "http://example.com/images/1.jpg", image, tc.path)
+
+		params.Encoding = tc.params.Encoding
+		assert.Equal(t, tc.params, params, tc.path)
+	}
+
+	for _, path := range []string{
+		"rs:fill:300:200/",
+		"rs:crop:300:200/" + encoded,
+		"rs:fill:300:200/g:up/" + encoded,
+		"rs:fill:300:200/bl:10/" + encoded,
+		"rs:fill:abc:200/" + encoded,
+		"rs:fill:300:200/plain/",
+		"g:ce/" + encoded,
+		"rs:fill:300:200:1/" + encoded,
+		"rs:fill:300:200:0:1/" + encoded,
+		"s:300:200:1/" + encoded,
+		"rs:fill:300:200/g:no:10:0/" + encoded,
+		"rs:fill:300:200/g:fp:0.5:0.5:1/" + encoded,
+	} {
+		_, _, err := app.parseImgproxyParams(path)
+		assert.Equal(t, resizer.ErrInvalidParams, errors.Cause(err), path)
+	}
+}
@@ -0,0 +1,125 @@
+package app
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/ivanovaleksey/resizer/internal/pkg/preset"
+	"github.com/ivanovaleksey/resizer/internal/pkg/resizer"
+)
+
+const presetParamName = "preset"
+
+// transformParamNames are the query parameters a preset stands for.
+var transformParamNames = []string{
+	widthParamName,
+	heightParamName,
+	modeParamName,
+	gravityParamName,
+	focalPointXParamName,
+	focalPointYParamName,
+	formatParamName,
+	qualityParamName,
+	compressionParamName,
+	opsParamName,
+	metadataParamName,
+}
+
+// PresetImage serves /image/preset/{name}?url=...
+func (a *Application) PresetImage(w http.ResponseWriter, r *http.Request) {
+	const urlParamName = "url"
+
+	params, err := a.presetParams(chi.URLParam(r, "name"), r.URL.Query())
+	if err != nil {
+		a.writeError(w, err)
+		return
+	}
+
+	a.serveImage(w, r, r.URL.Query().Get(urlParamName), params)
+}
+
+// ReloadPresets loads presets from the configured file and replaces the current ones
+// only when all of them are valid. It is safe to call while serving requests.
+func (a *Application) ReloadPresets() error {
+	if a.config.PresetsFile == "" {
+		return nil
+	}
+
+	presets, err := preset.Load(a.config.PresetsFile)
+	if err != nil {
+		return err
+	}
+	for name, p := range presets {
+		if _, err := a.parseParams(presetValues(p)); err != nil {
+			return errors.Wrapf(err, "invalid preset %q", name)
+		}
+	}
+
+	a.presets.Replace(presets)
+	a.logger.Info("presets loaded", zap.Int("count", len(presets)))
+	return nil
+}
+
+// requestParams parses params of the query or of the preset it names.
+func (a *Application) requestParams(query url.Values) (resizer.Params, error) {
+	if name := query.Get(presetParamName); name != "" {
+		return a.presetParams(name, query)
+	}
+	if a.config.PresetsOnly {
+		return resizer.Params{}, errors.Wrap(resizer.ErrInvalidParams, "only presets are allowed")
+	}
+	return a.parseParams(query)
+}
+
+// presetParams returns params of the preset, the query must not override them.
+func (a *Application) presetParams(name string, query url.Values) (resizer.Params, error) {
+	for _, paramName := range transformParamNames {
+		if _, ok := query[paramName]; ok {
+			return resizer.Params{}, errors.Wrapf(resizer.ErrInvalidParams, "preset conflicts with %s", paramName)
+		}
+	}
+
+	p, ok := a.presets.Get(name)
+	if !ok {
+		return resizer.Params{}, errors.Wrapf(resizer.ErrInvalidParams, "unknown preset %q", name)
+	}
+	return a.parseParams(presetValues(p))
+}
+
+// presetValues returns the preset as query parameters.
+func presetValues(p preset.Preset) url.Values {
+	values := make(url.Values)
+	set := func(name, value string) {
+		if value != "" {
+			values.Set(name, value)
+		}
+	}
+	setInt := func(name string, value int) {
+		if value != 0 {
+			values.Set(name, strconv.Itoa(value))
+		}
+	}
+	setFloat := func(name string, value *float64) {
+		if value != nil {
+			values.Set(name, strconv.FormatFloat(*value, 'g', -1, 64))
+		}
+	}
+
+	setInt(widthParamName, p.Width)
+	setInt(heightParamName, p.Height)
+	set(modeParamName, p.Mode)
+	set(gravityParamName, p.Gravity)
+	setFloat(focalPointXParamName, p.FocalPointX)
+	setFloat(focalPointYParamName, p.FocalPointY)
+	set(formatParamName, p.Format)
+	setInt(qualityParamName, p.Quality)
+	set(compressionParamName, p.Compression)
+	set(opsParamName, p.Ops)
+	set(metadataParamName, p.Metadata)
+	return values
+}
@@ -1,65 +1,65 @@
 package app
 
 import (
-	"bytes"
-	"image/jpeg"
 	"net/http"
 	"strconv"
 
+	"github.com/pkg/errors"
 	"go.uber.org/zap"
 
 	"github.com/ivanovaleksey/resizer/internal/pkg/resizer"
 )
 
 func (a *Application) ResizeImage(w http.ResponseWriter, r *http.Request) {
-	const (
-		maxAge          = 3600
+	const urlParamName = "url"
 
-		urlParamName    = "url"
-		widthParamName  = "width"
-		heightParamName = "height"
-	)
+	params, err := a.requestParams(r.URL.Query())
+	if err != nil {
+		a.writeError(w, err)
+		return
+	}
+
+	a.serveImage(w, r, r.URL.Query().Get(urlParamName), params)
+}
+
+// serveImage responds with the image transformed according to params whatever URL scheme they came from.
+func (a *Application) serveImage(w http.ResponseWriter, r *http.Request, imageURL string, params resizer.Params) {
+	const maxAge = 3600
 
 	a.logger.Debug("resize image: start")
 
 	ctx := r.Context()
 
-	imageURL := r.URL.Query().Get(urlParamName)
-
-	imageWidth, err := strconv.Atoi(r.URL.Query().Get(widthParamName))
-	if err != nil {
-		a.logger.Error("can't parse width", zap.Error(err))
-		http.Error(w, "invalid width", http.StatusUnprocessableEntity)
-		return
+	if params.Format == "" {
+		params.Accept = acceptedFormats(r.Header.Get("Accept"))
+		w.Header().Set("Vary", "Accept")
 	}
 
-	imageHeight, err := strconv.Atoi(r.URL.Query().Get(heightParamName))
+	etag, err := a.resizeService.ETag(ctx, imageURL, params)
 	if err != nil {
-		a.logger.Error("can't parse height", zap.Error(err))
-		http.Error(w, "invalid height", http.StatusUnprocessableEntity)
+		a.writeError(w, errors.Wrap(err, "can't get etag"))
 		return
 	}
 
-	params := resizer.Params{Width: imageWidth, Height: imageHeight}
-	image, err := a.resizeService.Resize(ctx, imageURL, params)
-	if err != nil {
-		a.logger.Error("can't resize image", zap.Error(err))
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	w.Header().Set("Cache-Control", "max-age="+strconv.Itoa(maxAge))
+	w.Header().Set("ETag", etag)
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		a.logger.Debug("resize image: not modified")
 		return
 	}
 
-	buf := &bytes.Buffer{}
-	err = jpeg.Encode(buf, image, nil)
+	result, err := a.resizeService.Resize(ctx, imageURL, params)
 	if err != nil {
-		a.logger.Error("can't write image", zap.Error(err))
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		a.writeError(w, errors.Wrap(err, "can't resize image"))
 		return
 	}
 
-	w.Header().Set("Cache-Control", "max-age="+strconv.Itoa(maxAge))
-	w.Header().Set("Content-Type", "image/jpeg")
-	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
-	if _, err := w.Write(buf.Bytes()); err != nil {
+	// the validator of the result actually served, the source may have changed since the lookup
+	w.Header().Set("ETag", result.ETag)
+	w.Header().Set("Content-Type", result.ContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(result.Data)))
+	if _, err := w.Write(result.Data); err != nil {
 		a.logger.Error("can't write response", zap.Error(err))
 		return
 	}
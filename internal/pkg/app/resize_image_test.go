@@ -4,10 +4,13 @@ package app
 
 import (
 	"context"
+	"encoding/json"
 	"image/jpeg"
+	"image/png"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
-	"path"
+	"os"
 	"strings"
 	"testing"
 
@@ -15,6 +18,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
 
+	"github.com/ivanovaleksey/resizer/pkg/signature"
 	"github.com/ivanovaleksey/resizer/test"
 )
 
@@ -22,8 +26,9 @@ func TestApplication_ResizeImage(t *testing.T) {
 	logger, err := zap.NewDevelopment()
 	require.NoError(t, err)
 
+	root := test.RootDir(t, 3)
 	params := []string{
-		"url=" + path.Join(test.RootDir(t, 3), "test/testdata/nature.jpg"),
+		"url=test/testdata/nature.jpg",
 		"width=500",
 		"height=300",
 	}
@@ -36,7 +41,7 @@ func TestApplication_ResizeImage(t *testing.T) {
 
 	t.Run("it resizes image", func(t *testing.T) {
 		app := NewApp(context.Background(), logger)
-		err = app.Init(Config{ImageProvider: ImageProviderFile})
+		err = app.Init(Config{ImageProvider: ImageProviderFile, FileRoot: root})
 		require.NoError(t, err)
 
 		rr := httptest.NewRecorder()
@@ -45,6 +50,8 @@ func TestApplication_ResizeImage(t *testing.T) {
 		handler.ServeHTTP(rr, req)
 
 		require.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "image/jpeg", rr.Header().Get("Content-Type"))
+		assert.Equal(t, "Accept", rr.Header().Get("Vary"))
 
 		cfg, err := jpeg.DecodeConfig(rr.Body)
 		require.NoError(t, err)
@@ -52,9 +59,181 @@ func TestApplication_ResizeImage(t *testing.T) {
 		assert.Equal(t, 300, cfg.Height)
 	})
 
+	t.Run("it converts format", func(t *testing.T) {
+		app := NewApp(context.Background(), logger)
+		err = app.Init(Config{ImageProvider: ImageProviderFile, FileRoot: root})
+		require.NoError(t, err)
+
+		req := httptest.NewRequest("GET", req.URL.String()+"&format=png", nil)
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(app.ResizeImage)
+
+		handler.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "image/png", rr.Header().Get("Content-Type"))
+		assert.Empty(t, rr.Header().Get("Vary"))
+
+		cfg, err := png.DecodeConfig(rr.Body)
+		require.NoError(t, err)
+		assert.Equal(t, 500, cfg.Width)
+		assert.Equal(t, 300, cfg.Height)
+	})
+
+	t.Run("it applies operations", func(t *testing.T) {
+		app := NewApp(context.Background(), logger)
+		err = app.Init(Config{ImageProvider: ImageProviderFile, FileRoot: root})
+		require.NoError(t, err)
+
+		req := httptest.NewRequest("GET", "/image/resize?"+params[0]+"&ops=resize:500x300,fill%7Crotate:90%7Cgrayscale", nil)
+		rr := httptest.NewRecorder()
+		app.Handler().ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		cfg, err := jpeg.DecodeConfig(rr.Body)
+		require.NoError(t, err)
+		assert.Equal(t, 300, cfg.Width)
+		assert.Equal(t, 500, cfg.Height)
+
+		req = httptest.NewRequest("GET", "/image/resize?"+params[0]+"&ops=resize:500x300%7Cexplode", nil)
+		rr = httptest.NewRecorder()
+		app.Handler().ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("it supports presets", func(t *testing.T) {
+		presetsFile, err := ioutil.TempFile("", "presets*.yaml")
+		require.NoError(t, err)
+		defer os.Remove(presetsFile.Name())
+		writePresets := func(data string) {
+			require.NoError(t, ioutil.WriteFile(presetsFile.Name(), []byte(data), 0600))
+		}
+		writePresets("card:\n  width: 500\n  height: 300\n  mode: fill\n")
+
+		app := NewApp(context.Background(), logger)
+		err = app.Init(Config{ImageProvider: ImageProviderFile, FileRoot: root, PresetsFile: presetsFile.Name(), PresetsOnly: true})
+		require.NoError(t, err)
+
+		get := func(target string) *httptest.ResponseRecorder {
+			rr := httptest.NewRecorder()
+			app.Handler().ServeHTTP(rr, httptest.NewRequest("GET", target, nil))
+			return rr
+		}
+
+		for _, target := range []string{
+			"/image/preset/card?" + params[0],
+			"/image/resize?preset=card&" + params[0],
+		} {
+			rr := get(target)
+			require.Equal(t, http.StatusOK, rr.Code, target)
+			cfg, err := jpeg.DecodeConfig(rr.Body)
+			require.NoError(t, err)
+			assert.Equal(t, 500, cfg.Width)
+			assert.Equal(t, 300, cfg.Height)
+		}
+
+		for _, target := range []string{
+			req.URL.String(),
+			"/image/preset/card?" + params[0] + "&width=5000",
+			"/image/preset/missing?" + params[0],
+			"/thumbor/unsafe/500x300/test%2Ftestdata%2Fnature.jpg",
+		} {
+			assert.Equal(t, http.StatusBadRequest, get(target).Code, target)
+		}
+
+		writePresets("card:\n  width: 200\n  mode: unknown\n")
+		assert.Error(t, app.ReloadPresets())
+		assert.Equal(t, http.StatusOK, get("/image/preset/card?"+params[0]).Code)
+
+		writePresets("card:\n  width: 200\n  height: 100\n")
+		require.NoError(t, app.ReloadPresets())
+		rr := get("/image/preset/card?" + params[0])
+		require.Equal(t, http.StatusOK, rr.Code)
+		cfg, err := jpeg.DecodeConfig(rr.Body)
+		require.NoError(t, err)
+		assert.Equal(t, 200, cfg.Width)
+	})
+
+	t.Run("it respects quality", func(t *testing.T) {
+		app := NewApp(context.Background(), logger)
+		err = app.Init(Config{ImageProvider: ImageProviderFile, FileRoot: root, Quality: QualityConfig{Min: 20, Max: 90}})
+		require.NoError(t, err)
+
+		handler := http.HandlerFunc(app.ResizeImage)
+		sizes := make(map[string]int)
+		for _, quality := range []string{"1", "20", "90", "100"} {
+			req := httptest.NewRequest("GET", req.URL.String()+"&quality="+quality, nil)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			require.Equal(t, http.StatusOK, rr.Code)
+			sizes[quality] = rr.Body.Len()
+		}
+
+		assert.Less(t, sizes["20"], sizes["90"])
+		assert.Equal(t, sizes["1"], sizes["20"])
+		assert.Equal(t, sizes["100"], sizes["90"])
+	})
+
+	t.Run("it responds with structured errors", func(t *testing.T) {
+		app := NewApp(context.Background(), logger)
+		err = app.Init(Config{ImageProvider: ImageProviderFile, FileRoot: root})
+		require.NoError(t, err)
+
+		cases := []struct {
+			query  string
+			status int
+			code   string
+		}{
+			{"url=test/testdata/missing.jpg&width=100", http.StatusNotFound, "not_found"},
+			{"url=go.mod&width=100", http.StatusUnsupportedMediaType, "unsupported_media_type"},
+			{"url=/etc/passwd&width=100", http.StatusForbidden, "forbidden"},
+			{"url=../../etc/passwd&width=100", http.StatusForbidden, "forbidden"},
+			{params[0] + "&width=-1", http.StatusBadRequest, "invalid_params"},
+			{params[0] + "&width=abc", http.StatusBadRequest, "invalid_params"},
+		}
+
+		handler := http.HandlerFunc(app.ResizeImage)
+		for _, tc := range cases {
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest("GET", "/image/resize?"+tc.query, nil))
+
+			require.Equal(t, tc.status, rr.Code, tc.query)
+			assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+
+			var body errorResponse
+			require.NoError(t, json.NewDecoder(rr.Body).Decode(&body))
+			assert.Equal(t, tc.status, body.Status)
+			assert.Equal(t, tc.code, body.Code)
+			assert.NotEmpty(t, body.Message)
+		}
+	})
+
+	t.Run("it verifies signatures", func(t *testing.T) {
+		app := NewApp(context.Background(), logger)
+		err = app.Init(Config{ImageProvider: ImageProviderFile, FileRoot: root, SignatureKeys: [][]byte{[]byte("secret")}})
+		require.NoError(t, err)
+
+		signer, err := signature.NewSigner([]byte("secret"))
+		require.NoError(t, err)
+		signed, err := signer.SignURL(req.URL.String())
+		require.NoError(t, err)
+
+		handler := app.Handler()
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", signed, nil))
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		for _, target := range []string{req.URL.String(), signed + "&width=5000"} {
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest("GET", target, nil))
+			assert.Equal(t, http.StatusForbidden, rr.Code, target)
+		}
+	})
+
 	t.Run("it supports browser caching", func(t *testing.T) {
 		app := NewApp(context.Background(), logger)
-		err = app.Init(Config{ImageProvider: ImageProviderFile})
+		err = app.Init(Config{ImageProvider: ImageProviderFile, FileRoot: root})
 		require.NoError(t, err)
 
 		rr1 := httptest.NewRecorder()
@@ -69,15 +248,58 @@ func TestApplication_ResizeImage(t *testing.T) {
 		req.Header.Set("If-None-Match", etag)
 		rr2 := httptest.NewRecorder()
 		handler.ServeHTTP(rr2, req)
-		//it is because of encode/decode
-		assert.Equal(t, http.StatusOK, rr2.Code)
-		assert.NotEmpty(t, rr2.Body)
+		assert.Equal(t, http.StatusNotModified, rr2.Code)
+		assert.Empty(t, rr2.Body)
+	})
 
-		etag = rr2.Header().Get("Etag")
-		req.Header.Set("If-None-Match", etag)
-		rr3 := httptest.NewRecorder()
-		handler.ServeHTTP(rr3, req)
-		assert.Equal(t, http.StatusNotModified, rr3.Code)
-		assert.Empty(t, rr3.Body)
+	t.Run("it supports path url schemes", func(t *testing.T) {
+		imgproxyKey := signature.ImgproxyKey{Key: []byte("key"), Salt: []byte("salt")}
+		app := NewApp(context.Background(), logger)
+		err = app.Init(Config{
+			ImageProvider: ImageProviderFile,
+			FileRoot:      root,
+			ThumborKeys:   [][]byte{[]byte("secret")},
+			ImgproxyKeys:  []signature.ImgproxyKey{imgproxyKey},
+		})
+		require.NoError(t, err)
+
+		thumbor, err := signature.NewThumborSigner([]byte("secret"))
+		require.NoError(t, err)
+		imgproxy, err := signature.NewImgproxySigner(imgproxyKey)
+		require.NoError(t, err)
+
+		handler := app.Handler()
+		for _, tc := range []struct {
+			prefix, path string
+			sign         func(string) string
+		}{
+			{"/thumbor/", "500x300/smart/test%2Ftestdata%2Fnature.jpg", thumbor.SignPath},
+			{"/imgproxy/", "rs:fill:500:300/g:sm/plain/test/testdata/nature.jpg", imgproxy.SignPath},
+		} {
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest("GET", tc.prefix+tc.sign(tc.path)+"/"+tc.path, nil))
+			require.Equal(t, http.StatusOK, rr.Code, tc.path)
+
+			cfg, err := jpeg.DecodeConfig(rr.Body)
+			require.NoError(t, err)
+			assert.Equal(t, 500, cfg.Width)
+			assert.Equal(t, 300, cfg.Height)
+
+			for _, sig := range []string{"unsafe", tc.sign("1" + tc.path)} {
+				rr := httptest.NewRecorder()
+				handler.ServeHTTP(rr, httptest.NewRequest("GET", tc.prefix+sig+"/"+tc.path, nil))
+				assert.Equal(t, http.StatusForbidden, rr.Code, tc.path)
+			}
+		}
+	})
+
+	t.Run("it refuses unsigned path schemes when signing is enabled", func(t *testing.T) {
+		app := NewApp(context.Background(), logger)
+		err = app.Init(Config{ImageProvider: ImageProviderFile, FileRoot: root, SignatureKeys: [][]byte{[]byte("secret")}})
+		require.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+		app.Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/thumbor/unsafe/500x300/test%2Ftestdata%2Fnature.jpg", nil))
+		assert.Equal(t, http.StatusForbidden, rr.Code)
 	})
 }
@@ -0,0 +1,16 @@
+package app
+
+import "net/http"
+
+// verifySignature rejects requests without a valid signature when signing is enabled.
+func (a *Application) verifySignature(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.signer != nil {
+			if err := a.signer.Verify(r.URL.EscapedPath(), r.URL.Query()); err != nil {
+				a.writeError(w, err)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,148 @@
+package app
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/ivanovaleksey/resizer/internal/pkg/resizer"
+)
+
+var (
+	thumborSize = regexp.MustCompile(`^(-?)(\d*)x(-?)(\d*)$`)
+	thumborCrop = regexp.MustCompile(`^\d+x\d+:\d+x\d+$`)
+)
+
+// thumborGravity maps horizontal and vertical alignments to gravity.
+var thumborGravity = map[[2]string]resizer.Gravity{
+	{"left", "top"}:      resizer.GravityNorthWest,
+	{"center", "top"}:    resizer.GravityNorth,
+	{"right", "top"}:     resizer.GravityNorthEast,
+	{"left", "middle"}:   resizer.GravityWest,
+	{"center", "middle"}: resizer.GravityCenter,
+	{"right", "middle"}:  resizer.GravityEast,
+	{"left", "bottom"}:   resizer.GravitySouthWest,
+	{"center", "bottom"}: resizer.GravitySouth,
+	{"right", "bottom"}:  resizer.GravitySouthEast,
+}
+
+// parseThumborParams parses thumbor style paths:
+//
+//	[fit-in/][WxH/][halign/][valign/][smart/][filters:name(args):.../]image
+//
+// The image is the rest of the path which may be URL encoded.
+// Trimming, manual cropping, flipping and metadata endpoints are not supported,
+// neither are filters other than quality, format, strip_icc and strip_exif.
+// They are rejected, so results never silently differ from the ones of thumbor.
+func (a *Application) parseThumborParams(path string) (string, resizer.Params, error) {
+	params := resizer.Params{
+		Mode:    resizer.ModeStretch,
+		Gravity: resizer.GravityCenter,
+	}
+	params.Encoding.Quality = a.config.Quality.Default
+
+	var (
+		segments       = strings.Split(path, "/")
+		halign, valign = "center", "middle"
+		fitIn, smart   bool
+		image          string
+	)
+
+loop:
+	for i, segment := range segments {
+		switch {
+		case i == 0 && (segment == "meta" || segment == "debug"):
+			return "", params, errors.Wrapf(resizer.ErrInvalidParams, "%s is not supported", segment)
+		case segment == "trim" || strings.HasPrefix(segment, "trim:"):
+			return "", params, errors.Wrap(resizer.ErrInvalidParams, "trim is not supported")
+		case thumborCrop.MatchString(segment):
+			return "", params, errors.Wrap(resizer.ErrInvalidParams, "manual crop is not supported")
+		case segment == "fit-in" || segment == "adaptive-fit-in" || segment == "full-fit-in":
+			fitIn = true
+		case thumborSize.MatchString(segment):
+			m := thumborSize.FindStringSubmatch(segment)
+			if m[1] != "" || m[3] != "" {
+				return "", params, errors.Wrap(resizer.ErrInvalidParams, "flipping is not supported")
+			}
+			var err error
+			if params.Width, err = parseDimension(m[2]); err != nil {
+				return "", params, invalidParam("width")
+			}
+			if params.Height, err = parseDimension(m[4]); err != nil {
+				return "", params, invalidParam("height")
+			}
+		case segment == "left" || segment == "right":
+			halign = segment
+		case segment == "top" || segment == "bottom":
+			valign = segment
+		case segment == "center":
+			halign = segment
+		case segment == "middle":
+			valign = segment
+		case segment == "smart":
+			smart = true
+		case strings.HasPrefix(segment, "filters:"):
+			if err := a.applyThumborFilters(&params, strings.TrimPrefix(segment, "filters:")); err != nil {
+				return "", params, err
+			}
+		default:
+			image = strings.Join(segments[i:], "/")
+			break loop
+		}
+	}
+
+	if image == "" {
+		return "", params, errors.Wrap(resizer.ErrInvalidParams, "missing image")
+	}
+	imageURL, err := url.PathUnescape(image)
+	if err != nil {
+		return "", params, invalidParam("image")
+	}
+
+	switch {
+	case fitIn:
+		params.Mode = resizer.ModeFit
+	case params.Width > 0 && params.Height > 0:
+		params.Mode = resizer.ModeFill
+	}
+	params.Gravity = thumborGravity[[2]string{halign, valign}]
+	if smart {
+		params.Gravity = resizer.GravitySmart
+	}
+
+	if err := params.Validate(); err != nil {
+		return "", params, err
+	}
+	return imageURL, params, nil
+}
+
+// applyThumborFilters applies filters given as name(args):name(args).
+func (a *Application) applyThumborFilters(params *resizer.Params, filters string) error {
+	for filters != "" {
+		open := strings.IndexByte(filters, '(')
+		end := strings.IndexByte(filters, ')')
+		if open < 0 || end < open {
+			return invalidParam("filters")
+		}
+		name, arg := filters[:open], filters[open+1:end]
+		filters = strings.TrimPrefix(filters[end+1:], ":")
+
+		switch name {
+		case "quality":
+			quality, err := a.parseQuality(arg)
+			if err != nil {
+				return err
+			}
+			params.Encoding.Quality = quality
+		case "format":
+			params.Format = parseFormat(arg)
+		case "strip_icc", "strip_exif":
+			// outputs carry no metadata anyway
+		default:
+			return errors.Wrapf(resizer.ErrInvalidParams, "filter %q is not supported", name)
+		}
+	}
+	return nil
+}
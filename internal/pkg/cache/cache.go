@@ -1,59 +1,99 @@
 package cache
 
 import (
-	"bytes"
-	"image"
-	"image/jpeg"
 	"time"
 
 	"github.com/allegro/bigcache"
+	"github.com/pkg/errors"
 )
 
 const (
 	TTL     = 3600 * time.Second
 	MaxSize = 1024 // in MB
+
+	// DefaultMaxEntrySize fits the largest source image fetched by default.
+	DefaultMaxEntrySize = 32 << 20
+
+	// entryOverhead covers the key, the content type and the etag stored along with the data.
+	entryOverhead = 4 << 10
 )
 
 type Cache struct {
 	inner *bigcache.BigCache
 }
 
-func NewCache() (Cache, error) {
+type Option func(*settings)
+
+type settings struct {
+	maxEntrySize int
+}
+
+// WithMaxEntrySize sets the size of the largest data in bytes the cache must hold.
+// Every shard holds at most MaxSize / shards, so larger entries mean fewer shards.
+func WithMaxEntrySize(size int) Option {
+	return func(s *settings) {
+		if size > 0 {
+			s.maxEntrySize = size
+		}
+	}
+}
+
+func NewCache(opts ...Option) (Cache, error) {
+	s := settings{maxEntrySize: DefaultMaxEntrySize}
+	for _, opt := range opts {
+		opt(&s)
+	}
+
 	cfg := bigcache.DefaultConfig(TTL)
 	cfg.HardMaxCacheSize = MaxSize
+	cfg.Shards = shardCount(MaxSize<<20, s.maxEntrySize+entryOverhead)
 	cfg.CleanWindow = 1 * time.Second
+	if cfg.Shards*(s.maxEntrySize+entryOverhead) > MaxSize<<20 {
+		return Cache{}, errors.Errorf("entries of %d bytes don't fit %d MB", s.maxEntrySize, MaxSize)
+	}
 
 	cache, err := bigcache.NewBigCache(cfg)
 	if err != nil {
-		return Cache{}, nil
+		return Cache{}, err
 	}
 
 	return Cache{inner: cache}, nil
 }
 
-func (c Cache) Get(entity Entity) (image.Image, error) {
+// shardCount returns the largest power of two number of shards which hold an entry each.
+func shardCount(size, entrySize int) int {
+	shards := 1
+	for shards*2*entrySize <= size && shards < 1024 {
+		shards *= 2
+	}
+	return shards
+}
+
+func (c Cache) Get(entity Entity) (Item, error) {
 	value, err := c.inner.Get(entity.Key())
 	if err == bigcache.ErrEntryNotFound {
-		return nil, ErrCacheMiss
-	}
-	if err != nil {
-		return nil, err
+		return Item{}, ErrCacheMiss
 	}
-
-	img, err := jpeg.Decode(bytes.NewReader(value))
 	if err != nil {
-		return nil, err
+		return Item{}, err
 	}
 
-	return img, nil
+	return unmarshalItem(value)
 }
 
-func (c Cache) Set(entity Entity, value image.Image) error {
-	buf := bytes.NewBuffer(nil)
-	err := jpeg.Encode(buf, value, nil)
-	if err != nil {
-		return err
+func (c Cache) Set(entity Entity, value Item) error {
+	data := value.marshal()
+	if err := c.inner.Set(entity.Key(), data); err != nil {
+		return errors.Wrapf(err, "can't set %d bytes", len(data))
 	}
+	return nil
+}
 
-	return c.inner.Set(entity.Key(), buf.Bytes())
+// Delete removes the entity, a missing one is not an error.
+func (c Cache) Delete(entity Entity) error {
+	err := c.inner.Delete(entity.Key())
+	if err == bigcache.ErrEntryNotFound {
+		return nil
+	}
+	return err
 }
@@ -0,0 +1,41 @@
+package cache
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache(t *testing.T) {
+	t.Run("it keeps large images", func(t *testing.T) {
+		c, err := NewCache()
+		require.NoError(t, err)
+
+		item := Item{ContentType: "image/jpeg", ETag: `"v1"`, Data: bytes.Repeat([]byte{1}, 5<<20)}
+		require.NoError(t, c.Set("large", item))
+
+		got, err := c.Get("large")
+		require.NoError(t, err)
+		assert.Equal(t, item, got)
+	})
+
+	t.Run("it rejects entries larger than the limit", func(t *testing.T) {
+		c, err := NewCache(WithMaxEntrySize(1 << 20))
+		require.NoError(t, err)
+
+		assert.Error(t, c.Set("large", Item{Data: make([]byte, 2<<20)}))
+	})
+
+	t.Run("it rejects limits larger than the cache", func(t *testing.T) {
+		_, err := NewCache(WithMaxEntrySize(2 * MaxSize << 20))
+		assert.Error(t, err)
+	})
+}
+
+func TestShardCount(t *testing.T) {
+	assert.Equal(t, 16, shardCount(1024<<20, 32<<20+entryOverhead))
+	assert.Equal(t, 512, shardCount(1024<<20, 1<<20+entryOverhead))
+	assert.Equal(t, 1024, shardCount(1024<<20, 100))
+}
@@ -1,6 +1,9 @@
 package cache
 
-const ErrCacheMiss = Error("cache miss")
+const (
+	ErrCacheMiss     = Error("cache miss")
+	ErrCorruptedItem = Error("corrupted cache item")
+)
 
 type Error string
 
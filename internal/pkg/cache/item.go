@@ -0,0 +1,51 @@
+package cache
+
+import (
+	"encoding/binary"
+)
+
+// Item is an encoded image along with its metadata.
+type Item struct {
+	ContentType string
+	ETag        string
+	Data        []byte
+}
+
+// marshal lays the item out as length-prefixed content type and etag followed by data.
+func (i Item) marshal() []byte {
+	buf := make([]byte, 0, 2*binary.MaxVarintLen64+len(i.ContentType)+len(i.ETag)+len(i.Data))
+	buf = appendString(buf, i.ContentType)
+	buf = appendString(buf, i.ETag)
+	return append(buf, i.Data...)
+}
+
+func unmarshalItem(buf []byte) (Item, error) {
+	var (
+		item Item
+		ok   bool
+	)
+	if item.ContentType, buf, ok = readString(buf); !ok {
+		return Item{}, ErrCorruptedItem
+	}
+	if item.ETag, buf, ok = readString(buf); !ok {
+		return Item{}, ErrCorruptedItem
+	}
+	item.Data = buf
+	return item, nil
+}
+
+// appendString prefixes the string with its varint length, so no length is truncated.
+func appendString(buf []byte, s string) []byte {
+	var size [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(size[:], uint64(len(s)))
+	return append(append(buf, size[:n]...), s...)
+}
+
+func readString(buf []byte) (string, []byte, bool) {
+	size, n := binary.Uvarint(buf)
+	if n <= 0 || size > uint64(len(buf)-n) {
+		return "", nil, false
+	}
+	end := n + int(size)
+	return string(buf[n:end]), buf[end:], true
+}
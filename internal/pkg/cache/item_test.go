@@ -0,0 +1,30 @@
+package cache
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestItem_Marshal(t *testing.T) {
+	t.Run("it keeps long values", func(t *testing.T) {
+		item := Item{
+			ContentType: "image/png",
+			ETag:        strings.Repeat("e", 70000),
+			Data:        []byte("data"),
+		}
+		got, err := unmarshalItem(item.marshal())
+		require.NoError(t, err)
+		assert.Equal(t, item, got)
+	})
+
+	t.Run("it rejects corrupted items", func(t *testing.T) {
+		buf := Item{ContentType: "image/png", ETag: "etag"}.marshal()
+		for _, b := range [][]byte{nil, buf[:5], {0xff}} {
+			_, err := unmarshalItem(b)
+			assert.Equal(t, ErrCorruptedItem, err)
+		}
+	})
+}
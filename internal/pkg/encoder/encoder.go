@@ -0,0 +1,109 @@
+package encoder
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	"github.com/pkg/errors"
+
+	"github.com/ivanovaleksey/resizer/internal/pkg/format"
+)
+
+// Options holds per-request encoding settings, zero values mean encoder defaults.
+// Encoders ignore options which don't apply to their format.
+type Options struct {
+	Quality     int                  // JPEG quality 1-100
+	Compression png.CompressionLevel // PNG compression level
+}
+
+type Encoder interface {
+	Encode(w io.Writer, img image.Image, opts Options) error
+}
+
+// EncoderFunc is an adapter to use ordinary functions as encoders.
+type EncoderFunc func(w io.Writer, img image.Image, opts Options) error
+
+func (f EncoderFunc) Encode(w io.Writer, img image.Image, opts Options) error {
+	return f(w, img, opts)
+}
+
+var encoders = map[format.Format]Encoder{
+	format.JPEG: EncoderFunc(encodeJPEG),
+	format.PNG:  EncoderFunc(encodePNG),
+	format.GIF:  EncoderFunc(encodeGIF),
+}
+
+// Register adds or replaces the encoder for the format.
+// It is not safe to call concurrently with Encode, so call it on start up.
+func Register(f format.Format, encoder Encoder) {
+	encoders[f] = encoder
+}
+
+// Supported reports whether there is an encoder for the format.
+func Supported(f format.Format) bool {
+	_, ok := encoders[f]
+	return ok
+}
+
+func Encode(w io.Writer, img image.Image, f format.Format, opts Options) error {
+	encoder, ok := encoders[f]
+	if !ok {
+		return errors.Errorf("unsupported output format %q", f)
+	}
+	return encoder.Encode(w, img, opts)
+}
+
+// HasAlpha reports whether the image has any transparent pixels.
+// Images which can't tell it are considered opaque.
+func HasAlpha(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return !o.Opaque()
+	}
+	return false
+}
+
+// encodeJPEG flattens transparent images onto white, otherwise they come out black.
+func encodeJPEG(w io.Writer, img image.Image, opts Options) error {
+	if HasAlpha(img) {
+		flat := image.NewRGBA(img.Bounds())
+		draw.Draw(flat, flat.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+		draw.Draw(flat, flat.Bounds(), img, img.Bounds().Min, draw.Over)
+		img = flat
+	}
+
+	var jpegOpts *jpeg.Options
+	if opts.Quality > 0 {
+		jpegOpts = &jpeg.Options{Quality: opts.Quality}
+	}
+	return jpeg.Encode(w, img, jpegOpts)
+}
+
+func encodePNG(w io.Writer, img image.Image, opts Options) error {
+	enc := png.Encoder{CompressionLevel: opts.Compression}
+	return enc.Encode(w, img)
+}
+
+func encodeGIF(w io.Writer, img image.Image, _ Options) error {
+	return gif.Encode(w, img, nil)
+}
+
+// ParseCompression parses a PNG compression level name.
+func ParseCompression(s string) (png.CompressionLevel, error) {
+	switch s {
+	case "", "default":
+		return png.DefaultCompression, nil
+	case "none":
+		return png.NoCompression, nil
+	case "fast":
+		return png.BestSpeed, nil
+	case "best":
+		return png.BestCompression, nil
+	default:
+		return 0, errors.Errorf("unknown compression %q", s)
+	}
+}
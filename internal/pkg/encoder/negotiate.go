@@ -0,0 +1,37 @@
+package encoder
+
+import "github.com/ivanovaleksey/resizer/internal/pkg/format"
+
+// Output preferences for auto format in order of priority.
+var (
+	opaquePreference = []format.Format{format.WebP, format.JPEG, format.PNG}
+	alphaPreference  = []format.Format{format.WebP, format.PNG, format.GIF}
+)
+
+// Negotiate picks the output format accepted by the client which keeps transparency if needed.
+func Negotiate(accepted []format.Format, hasAlpha bool) format.Format {
+	preference := opaquePreference
+	if hasAlpha {
+		preference = alphaPreference
+	}
+
+	for _, f := range preference {
+		if Supported(f) && contains(accepted, f) {
+			return f
+		}
+	}
+
+	if hasAlpha {
+		return format.PNG
+	}
+	return format.JPEG
+}
+
+func contains(formats []format.Format, f format.Format) bool {
+	for _, v := range formats {
+		if v == f {
+			return true
+		}
+	}
+	return false
+}
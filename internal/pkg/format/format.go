@@ -0,0 +1,96 @@
+package format
+
+import (
+	"bytes"
+	"mime"
+	"strings"
+)
+
+// Format is an image encoding format.
+type Format string
+
+const (
+	JPEG Format = "jpeg"
+	PNG  Format = "png"
+	GIF  Format = "gif"
+	BMP  Format = "bmp"
+	TIFF Format = "tiff"
+	WebP Format = "webp"
+)
+
+var contentTypes = map[Format]string{
+	JPEG: "image/jpeg",
+	PNG:  "image/png",
+	GIF:  "image/gif",
+	BMP:  "image/bmp",
+	TIFF: "image/tiff",
+	WebP: "image/webp",
+}
+
+// aliases lists non-canonical content types seen in the wild.
+var aliases = map[string]Format{
+	"image/jpg":      JPEG,
+	"image/pjpeg":    JPEG,
+	"image/x-png":    PNG,
+	"image/x-bmp":    BMP,
+	"image/x-ms-bmp": BMP,
+}
+
+type signature struct {
+	offset int
+	magic  []byte
+}
+
+var signatures = []struct {
+	format     Format
+	signatures []signature
+}{
+	{JPEG, []signature{{0, []byte("\xff\xd8\xff")}}},
+	{PNG, []signature{{0, []byte("\x89PNG\r\n\x1a\n")}}},
+	{GIF, []signature{{0, []byte("GIF87a")}, {0, []byte("GIF89a")}}},
+	{BMP, []signature{{0, []byte("BM")}}},
+	{TIFF, []signature{{0, []byte("II*\x00")}, {0, []byte("MM\x00*")}}},
+	{WebP, []signature{{8, []byte("WEBP")}}},
+}
+
+func (f Format) ContentType() string {
+	return contentTypes[f]
+}
+
+// Sniff detects the format by the magic bytes at the beginning of data.
+func Sniff(data []byte) (Format, bool) {
+	for _, s := range signatures {
+		for _, sig := range s.signatures {
+			end := sig.offset + len(sig.magic)
+			if len(data) >= end && bytes.Equal(data[sig.offset:end], sig.magic) {
+				return s.format, true
+			}
+		}
+	}
+	return "", false
+}
+
+// FromContentType detects the format by a Content-Type header value.
+func FromContentType(contentType string) (Format, bool) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", false
+	}
+	mediaType = strings.ToLower(mediaType)
+
+	for f, ct := range contentTypes {
+		if ct == mediaType {
+			return f, true
+		}
+	}
+	f, ok := aliases[mediaType]
+	return f, ok
+}
+
+// Detect prefers magic bytes and falls back to the content type.
+func Detect(data []byte, contentType string) (Format, bool) {
+	if f, ok := Sniff(data); ok {
+		return f, true
+	}
+	return FromContentType(contentType)
+}
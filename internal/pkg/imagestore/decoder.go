@@ -0,0 +1,114 @@
+package imagestore
+
+import (
+	"bytes"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	"github.com/disintegration/imaging"
+	"github.com/pkg/errors"
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+	"golang.org/x/image/webp"
+
+	"github.com/ivanovaleksey/resizer/internal/pkg/format"
+	"github.com/ivanovaleksey/resizer/internal/pkg/metadata"
+)
+
+// DecodeFunc decodes an image of a particular format.
+type DecodeFunc func(io.Reader) (image.Image, error)
+
+// DecodeConfigFunc reads dimensions of an image of a particular format without decoding it.
+type DecodeConfigFunc func(io.Reader) (image.Config, error)
+
+type decoder struct {
+	decode       DecodeFunc
+	decodeConfig DecodeConfigFunc
+}
+
+// decoders decode the first frame of animations only, it lies within the canvas checked
+// against the limits, so the number of frames can't blow the memory up.
+var decoders = map[format.Format]decoder{
+	format.JPEG: {jpeg.Decode, jpeg.DecodeConfig},
+	format.PNG:  {png.Decode, png.DecodeConfig},
+	format.GIF:  {decodeGIF, gif.DecodeConfig},
+	format.BMP:  {bmp.Decode, bmp.DecodeConfig},
+	format.TIFF: {tiff.Decode, tiff.DecodeConfig},
+	format.WebP: {webp.Decode, webp.DecodeConfig},
+}
+
+// decodeGIF decodes the first frame, unlike gif.DecodeAll the rest is never read.
+func decodeGIF(r io.Reader) (image.Image, error) {
+	return gif.Decode(r)
+}
+
+// RegisterDecoder adds or replaces the decoder for the format.
+// It is not safe to call concurrently with Decode, so call it on start up.
+func RegisterDecoder(f format.Format, decode DecodeFunc, decodeConfig DecodeConfigFunc) {
+	decoders[f] = decoder{decode: decode, decodeConfig: decodeConfig}
+}
+
+// Decoder decodes sources of any registered format.
+// It reads the dimensions first, so images exceeding the limits are never allocated,
+// and applies the EXIF orientation, so results don't depend on viewers honoring it.
+type Decoder struct {
+	limits Limits
+}
+
+func NewDecoder(limits Limits) Decoder {
+	return Decoder{limits: limits}
+}
+
+// Decode detects the format of the source by its magic bytes, then by the content type, and decodes it.
+func (d Decoder) Decode(src Source) (image.Image, format.Format, error) {
+	f, ok := format.Detect(src.Data, src.ContentType)
+	if !ok {
+		return nil, "", errors.Wrapf(ErrUnsupportedFormat, "unknown format of content type %q", src.ContentType)
+	}
+
+	dec, ok := decoders[f]
+	if !ok {
+		return nil, f, errors.Wrapf(ErrUnsupportedFormat, "no decoder for %s", f)
+	}
+
+	cfg, err := dec.decodeConfig(bytes.NewReader(src.Data))
+	if err != nil {
+		return nil, f, errors.Wrapf(ErrCorruptedImage, "can't decode %s config: %v", f, err)
+	}
+	if err := d.limits.Check(cfg.Width, cfg.Height); err != nil {
+		return nil, f, err
+	}
+
+	img, err := dec.decode(bytes.NewReader(src.Data))
+	if err != nil {
+		return nil, f, errors.Wrapf(ErrCorruptedImage, "can't decode %s: %v", f, err)
+	}
+
+	return orient(img, metadata.Orientation(src.Data, f)), f, nil
+}
+
+// orient transforms the image, so it is displayed upright without the orientation tag.
+func orient(img image.Image, orientation int) image.Image {
+	switch orientation {
+	case metadata.OrientationFlipH:
+		return imaging.FlipH(img)
+	case metadata.OrientationRotate180:
+		return imaging.Rotate180(img)
+	case metadata.OrientationFlipV:
+		return imaging.FlipV(img)
+	case metadata.OrientationTranspose:
+		return imaging.Transpose(img)
+	case metadata.OrientationRotate90:
+		// imaging rotates counter-clockwise
+		return imaging.Rotate270(img)
+	case metadata.OrientationTransverse:
+		return imaging.Transverse(img)
+	case metadata.OrientationRotate270:
+		return imaging.Rotate90(img)
+	default:
+		return img
+	}
+}
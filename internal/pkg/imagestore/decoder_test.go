@@ -0,0 +1,156 @@
+package imagestore
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+
+	"github.com/ivanovaleksey/resizer/internal/pkg/format"
+)
+
+func TestDecode(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 3))
+	img.Set(1, 1, color.NRGBA{R: 255, A: 128})
+
+	encoders := map[format.Format]func(io.Writer, image.Image) error{
+		format.JPEG: func(w io.Writer, img image.Image) error { return jpeg.Encode(w, img, nil) },
+		format.PNG:  png.Encode,
+		format.GIF:  func(w io.Writer, img image.Image) error { return gif.Encode(w, img, nil) },
+		format.BMP:  bmp.Encode,
+		format.TIFF: func(w io.Writer, img image.Image) error { return tiff.Encode(w, img, nil) },
+	}
+
+	for f, encode := range encoders {
+		t.Run(string(f), func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			require.NoError(t, encode(buf, img))
+
+			out, detected, err := Decoder{}.Decode(Source{ContentType: "application/octet-stream", Data: buf.Bytes()})
+			require.NoError(t, err)
+			assert.Equal(t, f, detected)
+			assert.Equal(t, img.Bounds(), out.Bounds())
+		})
+	}
+
+	t.Run("with exif orientation", func(t *testing.T) {
+		// stored 32x16 with the white corner at the top left
+		stored := image.NewGray(image.Rect(0, 0, 32, 16))
+		for x := 0; x < 16; x++ {
+			for y := 0; y < 8; y++ {
+				stored.SetGray(x, y, color.Gray{Y: 255})
+			}
+		}
+		buf := &bytes.Buffer{}
+		require.NoError(t, jpeg.Encode(buf, stored, nil))
+
+		landscape := []image.Point{{4, 4}, {28, 4}, {28, 12}, {4, 12}}
+		portrait := []image.Point{{4, 8}, {12, 8}, {12, 24}, {4, 24}}
+		cases := []struct {
+			orientation int
+			corners     []image.Point
+			white       int // index of the white corner
+		}{
+			{1, landscape, 0},
+			{2, landscape, 1},
+			{3, landscape, 2},
+			{4, landscape, 3},
+			{5, portrait, 0},
+			{6, portrait, 1},
+			{7, portrait, 2},
+			{8, portrait, 3},
+		}
+
+		for _, tc := range cases {
+			out, _, err := Decoder{}.Decode(Source{Data: withOrientation(buf.Bytes(), tc.orientation)})
+			require.NoError(t, err)
+
+			size := image.Pt(32, 16)
+			if tc.orientation >= 5 {
+				size = image.Pt(16, 32)
+			}
+			require.Equal(t, size, out.Bounds().Size(), "orientation %d", tc.orientation)
+			for i, p := range tc.corners {
+				gray := color.GrayModel.Convert(out.At(p.X, p.Y)).(color.Gray)
+				assert.Equal(t, i == tc.white, gray.Y > 128, "orientation %d at %v", tc.orientation, p)
+			}
+		}
+	})
+
+	t.Run("with unknown format", func(t *testing.T) {
+		_, _, err := Decoder{}.Decode(Source{ContentType: "text/html", Data: []byte("<html></html>")})
+		assert.Equal(t, ErrUnsupportedFormat, errors.Cause(err))
+	})
+
+	t.Run("with corrupted data", func(t *testing.T) {
+		_, detected, err := Decoder{}.Decode(Source{Data: []byte("\x89PNG\r\n\x1a\n...")})
+		assert.Equal(t, ErrCorruptedImage, errors.Cause(err))
+		assert.Equal(t, format.PNG, detected)
+	})
+
+	t.Run("with dimensions exceeding limits", func(t *testing.T) {
+		// a tiny PNG declaring 50000x50000 pixels
+		bomb := &bytes.Buffer{}
+		require.NoError(t, png.Encode(bomb, image.NewGray(image.Rect(0, 0, 1, 1))))
+		data := bomb.Bytes()
+		binary.BigEndian.PutUint32(data[16:], 50000)
+		binary.BigEndian.PutUint32(data[20:], 50000)
+		binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+
+		_, _, err := NewDecoder(Limits{MaxPixels: 50e6}).Decode(Source{Data: data})
+		assert.Equal(t, ErrDimensionsExceeded, errors.Cause(err))
+
+		limits := []Limits{{MaxWidth: 3}, {MaxHeight: 2}, {MaxPixels: 11}}
+		for _, l := range limits {
+			_, _, err := NewDecoder(l).Decode(Source{Data: pngData(t, img)})
+			assert.Equal(t, ErrDimensionsExceeded, errors.Cause(err), "%+v", l)
+		}
+
+		_, _, err = NewDecoder(Limits{MaxWidth: 4, MaxHeight: 3, MaxPixels: 12}).Decode(Source{Data: pngData(t, img)})
+		assert.NoError(t, err)
+	})
+
+	t.Run("with many frames", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		require.NoError(t, gif.Encode(buf, img, nil))
+
+		// the trailer is replaced with a frame which can't be decoded
+		data := append(buf.Bytes()[:buf.Len()-1], ',', 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0)
+		out, detected, err := NewDecoder(Limits{MaxPixels: 12}).Decode(Source{Data: data})
+		require.NoError(t, err)
+		assert.Equal(t, format.GIF, detected)
+		assert.Equal(t, img.Bounds(), out.Bounds())
+
+		_, err = gif.DecodeAll(bytes.NewReader(data))
+		assert.Error(t, err)
+	})
+}
+
+func pngData(t *testing.T, img image.Image) []byte {
+	buf := &bytes.Buffer{}
+	require.NoError(t, png.Encode(buf, img))
+	return buf.Bytes()
+}
+
+// withOrientation inserts a big endian EXIF segment with the orientation only.
+func withOrientation(data []byte, orientation int) []byte {
+	exif := []byte("Exif\x00\x00MM\x00*\x00\x00\x00\x08\x00\x01\x01\x12\x00\x03\x00\x00\x00\x01\x00\x00\x00\x00\x00\x00\x00\x00")
+	exif[25] = byte(orientation)
+
+	out := append([]byte{}, data[:2]...)
+	out = append(out, 0xff, 0xe1, 0, byte(len(exif)+2))
+	out = append(out, exif...)
+	return append(out, data[2:]...)
+}
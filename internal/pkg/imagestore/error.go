@@ -0,0 +1,38 @@
+package imagestore
+
+import (
+	"fmt"
+	"net/http"
+)
+
+const (
+	ErrNotFound           = Error("image not found")
+	ErrUnsupportedFormat  = Error("unsupported image format")
+	ErrCorruptedImage     = Error("corrupted image")
+	ErrTooLarge           = Error("image is too large")
+	ErrDimensionsExceeded = Error("image dimensions exceed limits")
+	ErrForbidden          = Error("upstream is forbidden")
+	ErrInvalidURL         = Error("invalid url")
+	ErrTooManyRedirects   = Error("too many redirects")
+)
+
+type Error string
+
+func (e Error) Error() string {
+	return string(e)
+}
+
+// StatusError is returned when the upstream responds with a non-2xx status.
+type StatusError struct {
+	URL        string
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status %d from %s", e.StatusCode, e.URL)
+}
+
+// NotFound reports whether the upstream has no such image.
+func (e *StatusError) NotFound() bool {
+	return e.StatusCode == http.StatusNotFound || e.StatusCode == http.StatusGone
+}
@@ -1,25 +1,113 @@
 package imagestore
 
 import (
-	"bytes"
 	"context"
-	"image"
-	"image/jpeg"
 	"io/ioutil"
+	"mime"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
 )
 
+// FileStore serves images from the root directory only.
 type FileStore struct {
+	root string
+}
+
+func NewFileStore(root string) (FileStore, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return FileStore{}, err
+	}
+	root, err = filepath.EvalSymlinks(root)
+	if err != nil {
+		return FileStore{}, errors.Wrap(err, "can't resolve root")
+	}
+	return FileStore{root: root}, nil
+}
+
+func (f FileStore) GetImage(_ context.Context, target string) (Source, error) {
+	file, path, err := f.open(target)
+	if err != nil {
+		return Source{}, err
+	}
+	defer file.Close()
+
+	buf, err := ioutil.ReadAll(file)
+	if err != nil {
+		return Source{}, err
+	}
+
+	src := Source{
+		ContentType: mime.TypeByExtension(filepath.Ext(path)),
+		ETag:        contentETag(buf),
+		Data:        buf,
+	}
+	return src, nil
 }
 
-func NewFileStore() FileStore {
-	return FileStore{}
+// open opens the regular file of the target within the root and returns its resolved path.
+// Absolute paths, traversal and symlinks leading outside of the root are refused.
+// The path is checked after the file is opened, so a symlink swapped in between can't escape the root.
+func (f FileStore) open(target string) (*os.File, string, error) {
+	if target == "" || filepath.IsAbs(target) || strings.HasPrefix(target, "/") {
+		return nil, "", errors.Wrapf(ErrForbidden, "path %q is not relative", target)
+	}
+
+	clean := filepath.Clean(filepath.FromSlash(target))
+	if clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return nil, "", errors.Wrapf(ErrForbidden, "path %q is outside of the root", target)
+	}
+
+	path := filepath.Join(f.root, clean)
+	file, err := os.Open(path)
+	if err != nil {
+		// missing files, files in place of directories, symlink loops and so on
+		return nil, "", errors.Wrapf(ErrNotFound, "%s: %v", target, err)
+	}
+	opened, err := f.check(file, path, target)
+	if err != nil {
+		file.Close()
+		return nil, "", err
+	}
+	return file, opened, nil
 }
 
-func (f FileStore) GetImage(_ context.Context, target string) (image.Image, error) {
-	buf, err := ioutil.ReadFile(target)
+// check ensures the opened file is a regular file within the root and returns its resolved path.
+func (f FileStore) check(file *os.File, path, target string) (string, error) {
+	info, err := file.Stat()
 	if err != nil {
-		return nil, err
+		return "", err
+	}
+	if !info.Mode().IsRegular() {
+		return "", errors.Wrap(ErrNotFound, target)
 	}
 
-	return jpeg.Decode(bytes.NewReader(buf))
+	opened, ok := openedPath(file)
+	if !ok {
+		// the path is resolved again, the file it leads to must be the opened one
+		if opened, err = filepath.EvalSymlinks(path); err != nil {
+			return "", errors.Wrapf(ErrNotFound, "%s: %v", target, err)
+		}
+		resolved, err := os.Lstat(opened)
+		if err != nil || !os.SameFile(info, resolved) {
+			return "", errors.Wrapf(ErrForbidden, "path %q changed while opened", target)
+		}
+	}
+	if !strings.HasPrefix(opened, f.root+string(filepath.Separator)) {
+		return "", errors.Wrapf(ErrForbidden, "path %q is outside of the root", target)
+	}
+	return opened, nil
+}
+
+// openedPath returns the path the file was actually opened at, where the system tells it.
+func openedPath(file *os.File) (string, bool) {
+	path, err := os.Readlink("/proc/self/fd/" + strconv.Itoa(int(file.Fd())))
+	if err != nil || !filepath.IsAbs(path) {
+		return "", false
+	}
+	return path, true
 }
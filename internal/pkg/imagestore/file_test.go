@@ -0,0 +1,74 @@
+package imagestore
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ivanovaleksey/resizer/test"
+)
+
+func TestFileStore_GetImage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filestore")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	root := filepath.Join(dir, "root")
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "images"), 0755))
+
+	data := test.SampleData(t, 3)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(root, "images", "nature.jpg"), data, 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "secret.jpg"), data, 0644))
+	require.NoError(t, os.Symlink(filepath.Join(root, "images", "nature.jpg"), filepath.Join(root, "inside.jpg")))
+	require.NoError(t, os.Symlink(filepath.Join(dir, "secret.jpg"), filepath.Join(root, "outside.jpg")))
+
+	store, err := NewFileStore(root)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+
+	t.Run("it reads files within root", func(t *testing.T) {
+		for _, target := range []string{"images/nature.jpg", "./images/../images/nature.jpg", "inside.jpg"} {
+			src, err := store.GetImage(ctx, target)
+			require.NoError(t, err, target)
+			assert.Equal(t, "image/jpeg", src.ContentType)
+			assert.Equal(t, data, src.Data)
+		}
+	})
+
+	t.Run("it refuses paths outside of root", func(t *testing.T) {
+		targets := []string{
+			filepath.Join(root, "images", "nature.jpg"),
+			"../secret.jpg",
+			"images/../../secret.jpg",
+			"outside.jpg",
+		}
+		for _, target := range targets {
+			_, err := store.GetImage(ctx, target)
+			assert.Equal(t, ErrForbidden, errors.Cause(err), target)
+		}
+	})
+
+	t.Run("it reports missing files", func(t *testing.T) {
+		for _, target := range []string{"missing.jpg", "images", "images/nature.jpg/x", "outside.jpg/x"} {
+			_, err := store.GetImage(ctx, target)
+			assert.Equal(t, ErrNotFound, errors.Cause(err), target)
+		}
+	})
+
+	t.Run("it checks the path of the opened file", func(t *testing.T) {
+		file, err := os.Open(filepath.Join(root, "outside.jpg"))
+		require.NoError(t, err)
+		defer file.Close()
+
+		// the symlink pointed inside when the path was checked
+		_, err = store.check(file, filepath.Join(root, "inside.jpg"), "inside.jpg")
+		assert.Equal(t, ErrForbidden, errors.Cause(err))
+	})
+}
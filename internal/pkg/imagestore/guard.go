@@ -0,0 +1,97 @@
+package imagestore
+
+import (
+	"net"
+	"net/url"
+	"path"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultDeniedNetworks are loopback, private, link-local and other special-purpose ranges
+// which must not be reachable through the url parameter.
+// IPv4-mapped IPv6 addresses are matched by the IPv4 ranges, so ::ffff:0:0/96 is not listed:
+// net.IPNet treats it as 0.0.0.0/0 and would deny every IPv4 address.
+var DefaultDeniedNetworks = []string{
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.0.0.0/24",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"224.0.0.0/4",
+	"240.0.0.0/4",
+	"::/128",
+	"::1/128",
+	"64:ff9b::/96",
+	"fc00::/7",
+	"fe80::/10",
+	"ff00::/8",
+}
+
+// ParseNetworks parses CIDR notations.
+func ParseNetworks(cidrs []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid network %q", cidr)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// guard decides which upstreams may be fetched.
+type guard struct {
+	allowedHosts   []string // glob patterns, empty allows any host
+	deniedNetworks []*net.IPNet
+	maxRedirects   int
+}
+
+// checkURL is applied to the requested URL and every redirect.
+func (g guard) checkURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.Wrapf(ErrForbidden, "scheme %q", u.Scheme)
+	}
+	if !g.hostAllowed(strings.ToLower(u.Hostname())) {
+		return errors.Wrapf(ErrForbidden, "host %q is not allowed", u.Hostname())
+	}
+	return nil
+}
+
+func (g guard) hostAllowed(host string) bool {
+	if len(g.allowedHosts) == 0 {
+		return true
+	}
+	for _, pattern := range g.allowedHosts {
+		if ok, _ := path.Match(pattern, host); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// control runs after DNS resolution, right before connecting,
+// so neither a DNS name nor a redirect can lead to a denied address.
+func (g guard) control(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return errors.Wrapf(ErrForbidden, "address %q", address)
+	}
+	for _, network := range g.deniedNetworks {
+		if network.Contains(ip) {
+			return errors.Wrapf(ErrForbidden, "address %s is denied", ip)
+		}
+	}
+	return nil
+}
@@ -2,33 +2,265 @@ package imagestore
 
 import (
 	"context"
-	"image"
-	"image/jpeg"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"mime"
+	"net"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultMaxBodySize is the default limit of the upstream response body.
+	DefaultMaxBodySize = 32 << 20
+
+	DefaultUserAgent = "resizer"
 )
 
 type HTTPStore struct {
-	client http.Client
+	client      http.Client
+	transport   transportConfig
+	guard       guard
+	maxBodySize int64
+	timeout     time.Duration
+
+	retries        int
+	retryBaseDelay time.Duration
+	retryMaxDelay  time.Duration
+
+	userAgent     string
+	originHeaders map[string]http.Header
+}
+
+type transportConfig struct {
+	dialTimeout           time.Duration
+	tlsHandshakeTimeout   time.Duration
+	responseHeaderTimeout time.Duration
+	maxIdleConnsPerHost   int
 }
 
-func NewHTTPStore() HTTPStore {
-	return HTTPStore{
-		client: http.Client{},
+func NewHTTPStore(opts ...HTTPOption) HTTPStore {
+	deniedNetworks, _ := ParseNetworks(DefaultDeniedNetworks)
+
+	s := HTTPStore{
+		transport: transportConfig{
+			dialTimeout:           2 * time.Second,
+			tlsHandshakeTimeout:   2 * time.Second,
+			responseHeaderTimeout: 5 * time.Second,
+			maxIdleConnsPerHost:   16,
+		},
+		maxBodySize:    DefaultMaxBodySize,
+		timeout:        8 * time.Second,
+		retries:        2,
+		retryBaseDelay: 100 * time.Millisecond,
+		retryMaxDelay:  time.Second,
+		userAgent:      DefaultUserAgent,
+		guard: guard{
+			deniedNetworks: deniedNetworks,
+			maxRedirects:   3,
+		},
+	}
+	for _, opt := range opts {
+		opt(&s)
+	}
+
+	s.client = http.Client{
+		Transport:     s.transport.build(s.guard),
+		CheckRedirect: s.checkRedirect,
+	}
+	return s
+}
+
+// build makes a transport which dials only the addresses allowed by the guard.
+// It ignores proxy settings, otherwise the proxy address would be checked instead of the upstream one.
+func (c transportConfig) build(g guard) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   c.dialTimeout,
+		KeepAlive: 30 * time.Second,
+		Control:   g.control,
+	}
+	return &http.Transport{
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   c.tlsHandshakeTimeout,
+		ResponseHeaderTimeout: c.responseHeaderTimeout,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   c.maxIdleConnsPerHost,
+		IdleConnTimeout:       90 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
 	}
 }
 
-func (d HTTPStore) GetImage(ctx context.Context, url string) (image.Image, error) {
-	req, err := http.NewRequest("GET", url, nil)
+// GetImage fetches the image retrying transient failures within the total timeout.
+func (d HTTPStore) GetImage(ctx context.Context, url string) (Source, error) {
+	if d.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.timeout)
+		defer cancel()
+	}
+
+	for attempt := 0; ; attempt++ {
+		src, err := d.fetch(ctx, url)
+		if err == nil || attempt >= d.retries || !retryable(ctx, err) {
+			return src, err
+		}
+
+		select {
+		case <-time.After(d.backoff(attempt)):
+		case <-ctx.Done():
+			return Source{}, err
+		}
+	}
+}
+
+func (d HTTPStore) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) > d.guard.maxRedirects {
+		return errors.Wrapf(ErrTooManyRedirects, "stopped after %d", d.guard.maxRedirects)
+	}
+	if err := d.guard.checkURL(req.URL); err != nil {
+		return err
+	}
+
+	// the client copies headers of the previous hop, credentials of one origin
+	// must not reach another one
+	d.setOriginHeaders(req)
+	return nil
+}
+
+// setOriginHeaders replaces headers configured for any origin with the ones of the request host.
+func (d HTTPStore) setOriginHeaders(req *http.Request) {
+	for host, header := range d.originHeaders {
+		if host == req.URL.Host {
+			continue
+		}
+		for name := range header {
+			req.Header.Del(name)
+		}
+	}
+	for name, values := range d.originHeaders[req.URL.Host] {
+		req.Header[name] = values
+	}
+}
+
+func (d HTTPStore) fetch(ctx context.Context, target string) (Source, error) {
+	req, err := http.NewRequest("GET", target, nil)
 	if err != nil {
-		return nil, err
+		return Source{}, errors.Wrap(ErrInvalidURL, err.Error())
 	}
 	req = req.WithContext(ctx)
 
+	if err := d.guard.checkURL(req.URL); err != nil {
+		return Source{}, err
+	}
+
+	req.Header.Set("User-Agent", d.userAgent)
+	d.setOriginHeaders(req)
+
 	resp, err := d.client.Do(req)
 	if err != nil {
-		return nil, err
+		return Source{}, unwrapClientError(err)
 	}
 	defer resp.Body.Close()
 
-	return jpeg.Decode(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return Source{}, &StatusError{URL: target, StatusCode: resp.StatusCode}
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if !isImageContentType(contentType) {
+		return Source{}, errors.Wrapf(ErrUnsupportedFormat, "content type %q of %s", contentType, target)
+	}
+
+	if resp.ContentLength > d.maxBodySize {
+		return Source{}, errors.Wrapf(ErrTooLarge, "%s has %d bytes", target, resp.ContentLength)
+	}
+
+	buf, err := ioutil.ReadAll(io.LimitReader(resp.Body, d.maxBodySize+1))
+	if err != nil {
+		return Source{}, err
+	}
+	if int64(len(buf)) > d.maxBodySize {
+		return Source{}, errors.Wrapf(ErrTooLarge, "%s exceeds %d bytes", target, d.maxBodySize)
+	}
+
+	src := Source{
+		ContentType: contentType,
+		ETag:        responseETag(resp.Header, buf),
+		Data:        buf,
+	}
+	return src, nil
+}
+
+// backoff returns a random delay up to the exponentially growing limit ("full jitter").
+func (d HTTPStore) backoff(attempt int) time.Duration {
+	limit := d.retryMaxDelay
+	if attempt < 30 {
+		if delay := d.retryBaseDelay << uint(attempt); delay < limit {
+			limit = delay
+		}
+	}
+	if limit <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(limit) + 1))
+}
+
+// retryable reports whether the error may go away on the next attempt:
+// 5xx responses and network failures, unless the caller has given up.
+func retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	switch cause := errors.Cause(err).(type) {
+	case *StatusError:
+		return cause.StatusCode >= 500
+	case *url.Error:
+		return cause.Err != context.Canceled && cause.Err != context.DeadlineExceeded
+	case net.Error:
+		return true
+	}
+	return err == io.ErrUnexpectedEOF
+}
+
+// unwrapClientError digs errors of the guard out of the client wrappers, so errors.Cause finds them.
+func unwrapClientError(err error) error {
+	inner := err
+	for {
+		switch e := inner.(type) {
+		case *url.Error:
+			inner = e.Err
+			continue
+		case *net.OpError:
+			inner = e.Err
+			continue
+		}
+		break
+	}
+
+	if _, ok := errors.Cause(inner).(Error); ok {
+		return inner
+	}
+	return err
+}
+
+// isImageContentType allows images and unspecified binary content, which is sniffed on decoding.
+func isImageContentType(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch mediaType = strings.ToLower(mediaType); mediaType {
+	case "application/octet-stream", "binary/octet-stream":
+		return true
+	default:
+		return strings.HasPrefix(mediaType, "image/")
+	}
 }
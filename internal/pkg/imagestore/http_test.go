@@ -0,0 +1,241 @@
+package imagestore
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ivanovaleksey/resizer/test"
+)
+
+func TestHTTPStore_GetImage(t *testing.T) {
+	data := test.SampleData(t, 3)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/image.jpg", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Header().Set("ETag", `"v1"`)
+		w.Write(data)
+	})
+	mux.HandleFunc("/unavailable", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("<html>Service Unavailable</html>"))
+	})
+	mux.HandleFunc("/page.html", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html></html>"))
+	})
+	var flakyCalls int32
+	mux.HandleFunc("/flaky.jpg", func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&flakyCalls, 1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write(data)
+	})
+	mux.HandleFunc("/slow.jpg", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.Write(data)
+	})
+	mux.HandleFunc("/private.jpg", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" || r.UserAgent() != "test-agent" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write(data)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	noDelay := WithRetryDelay(time.Millisecond, time.Millisecond)
+
+	ctx := context.Background()
+
+	t.Run("it fetches image", func(t *testing.T) {
+		src, err := newTestStore().GetImage(ctx, server.URL+"/image.jpg")
+		require.NoError(t, err)
+		assert.Equal(t, "image/jpeg", src.ContentType)
+		assert.Equal(t, `etag:"v1"`, src.ETag)
+		assert.Equal(t, data, src.Data)
+	})
+
+	t.Run("it rejects non-2xx status", func(t *testing.T) {
+		for path, status := range map[string]int{"/unavailable": 503, "/missing": 404} {
+			_, err := newTestStore(noDelay).GetImage(ctx, server.URL+path)
+			require.Error(t, err)
+
+			statusErr, ok := errors.Cause(err).(*StatusError)
+			require.True(t, ok, err.Error())
+			assert.Equal(t, status, statusErr.StatusCode)
+			assert.Equal(t, status == 404, statusErr.NotFound())
+		}
+	})
+
+	t.Run("it retries server errors", func(t *testing.T) {
+		atomic.StoreInt32(&flakyCalls, 0)
+		_, err := newTestStore(WithRetries(1), noDelay).GetImage(ctx, server.URL+"/flaky.jpg")
+		require.Error(t, err)
+		assert.EqualValues(t, 2, atomic.LoadInt32(&flakyCalls))
+
+		atomic.StoreInt32(&flakyCalls, 0)
+		_, err = newTestStore(WithRetries(2), noDelay).GetImage(ctx, server.URL+"/flaky.jpg")
+		require.NoError(t, err)
+		assert.EqualValues(t, 3, atomic.LoadInt32(&flakyCalls))
+	})
+
+	t.Run("it respects total timeout", func(t *testing.T) {
+		store := newTestStore(WithTimeout(50*time.Millisecond), WithRetries(5), noDelay)
+		start := time.Now()
+		_, err := store.GetImage(ctx, server.URL+"/slow.jpg")
+		require.Error(t, err)
+		assert.True(t, time.Since(start) < 150*time.Millisecond)
+	})
+
+	t.Run("it sends configured headers", func(t *testing.T) {
+		host := strings.TrimPrefix(server.URL, "http://")
+		opts := []HTTPOption{
+			WithUserAgent("test-agent"),
+			WithOriginHeaders(host, http.Header{"Authorization": {"Bearer secret"}}),
+		}
+		_, err := newTestStore(opts...).GetImage(ctx, server.URL+"/private.jpg")
+		assert.NoError(t, err)
+
+		_, err = newTestStore(WithUserAgent("test-agent")).GetImage(ctx, server.URL+"/private.jpg")
+		assert.Error(t, err)
+	})
+
+	t.Run("it sends configured headers only to their origin", func(t *testing.T) {
+		var received []http.Header
+		other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			received = append(received, r.Header)
+			w.Write(data)
+		}))
+		defer other.Close()
+
+		redirect := httptest.NewServer(http.RedirectHandler(other.URL+"/image.jpg", http.StatusFound))
+		defer redirect.Close()
+
+		opts := []HTTPOption{
+			WithOriginHeaders(strings.TrimPrefix(redirect.URL, "http://"), http.Header{"X-Api-Key": {"secret"}}),
+			WithOriginHeaders(strings.TrimPrefix(other.URL, "http://"), http.Header{"X-Token": {"other"}}),
+		}
+		_, err := newTestStore(opts...).GetImage(ctx, redirect.URL+"/image.jpg")
+		require.NoError(t, err)
+		require.Len(t, received, 1)
+		assert.Empty(t, received[0].Get("X-Api-Key"))
+		assert.Equal(t, "other", received[0].Get("X-Token"))
+	})
+
+	t.Run("it rejects non-image content type", func(t *testing.T) {
+		_, err := newTestStore().GetImage(ctx, server.URL+"/page.html")
+		assert.Equal(t, ErrUnsupportedFormat, errors.Cause(err))
+	})
+
+	t.Run("it limits body size", func(t *testing.T) {
+		store := newTestStore(WithMaxBodySize(int64(len(data) - 1)))
+		_, err := store.GetImage(ctx, server.URL+"/image.jpg")
+		assert.Equal(t, ErrTooLarge, errors.Cause(err))
+
+		store = newTestStore(WithMaxBodySize(int64(len(data))))
+		_, err = store.GetImage(ctx, server.URL+"/image.jpg")
+		assert.NoError(t, err)
+	})
+}
+
+func TestHTTPStore_Guard(t *testing.T) {
+	data := test.SampleData(t, 3)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/image.jpg", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(data)
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		n, _ := strconv.Atoi(r.URL.Query().Get("n"))
+		target := "/image.jpg"
+		if n > 1 {
+			target = "/redirect?n=" + strconv.Itoa(n-1)
+		}
+		http.Redirect(w, r, target, http.StatusFound)
+	})
+	mux.HandleFunc("/metadata", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://169.254.169.254/latest/meta-data/", http.StatusFound)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	ctx := context.Background()
+	noRetries := WithRetries(0)
+
+	t.Run("it denies private networks by default", func(t *testing.T) {
+		_, err := NewHTTPStore(noRetries).GetImage(ctx, server.URL+"/image.jpg")
+		assert.Equal(t, ErrForbidden, errors.Cause(err), err.Error())
+	})
+
+	t.Run("it checks allowed hosts", func(t *testing.T) {
+		_, err := newTestStore(WithAllowedHosts("*.example.com")).GetImage(ctx, server.URL+"/image.jpg")
+		assert.Equal(t, ErrForbidden, errors.Cause(err))
+
+		_, err = newTestStore(WithAllowedHosts("127.0.0.*")).GetImage(ctx, server.URL+"/image.jpg")
+		assert.NoError(t, err)
+	})
+
+	t.Run("it checks schemes", func(t *testing.T) {
+		_, err := newTestStore().GetImage(ctx, "file:///etc/passwd")
+		assert.Equal(t, ErrForbidden, errors.Cause(err))
+	})
+
+	t.Run("it limits redirects", func(t *testing.T) {
+		store := newTestStore(WithMaxRedirects(2))
+
+		_, err := store.GetImage(ctx, server.URL+"/redirect?n=2")
+		assert.NoError(t, err)
+
+		_, err = store.GetImage(ctx, server.URL+"/redirect?n=3")
+		assert.Equal(t, ErrTooManyRedirects, errors.Cause(err))
+	})
+
+	t.Run("it checks redirects", func(t *testing.T) {
+		deniedNetworks, err := ParseNetworks([]string{"169.254.0.0/16"})
+		require.NoError(t, err)
+
+		_, err = newTestStore(WithDeniedNetworks(deniedNetworks...)).GetImage(ctx, server.URL+"/metadata")
+		assert.Equal(t, ErrForbidden, errors.Cause(err))
+	})
+}
+
+func TestGuard_Control(t *testing.T) {
+	deniedNetworks, err := ParseNetworks(DefaultDeniedNetworks)
+	require.NoError(t, err)
+	g := guard{deniedNetworks: deniedNetworks}
+
+	for _, address := range []string{"8.8.8.8:80", "93.184.216.34:443", "[2606:4700::1111]:443"} {
+		assert.NoError(t, g.control("tcp", address, nil), address)
+	}
+	for _, address := range []string{"127.0.0.1:80", "10.1.2.3:80", "[::ffff:169.254.169.254]:80", "[::1]:80"} {
+		assert.Equal(t, ErrForbidden, errors.Cause(g.control("tcp", address, nil)), address)
+	}
+}
+
+// newTestStore allows to reach the test server on the loopback interface.
+func newTestStore(opts ...HTTPOption) HTTPStore {
+	return NewHTTPStore(append([]HTTPOption{WithDeniedNetworks()}, opts...)...)
+}
+
+func TestIsImageContentType(t *testing.T) {
+	for _, ct := range []string{"", "image/png", "IMAGE/JPEG; charset=binary", "application/octet-stream"} {
+		assert.True(t, isImageContentType(ct), ct)
+	}
+	for _, ct := range []string{"text/html", "application/json", strings.Repeat(";", 3)} {
+		assert.False(t, isImageContentType(ct), ct)
+	}
+}
@@ -0,0 +1,23 @@
+package imagestore
+
+import "github.com/pkg/errors"
+
+// Limits bound image dimensions, zero values mean no limit.
+type Limits struct {
+	MaxWidth  int
+	MaxHeight int
+	MaxPixels int64
+}
+
+func (l Limits) Check(width, height int) error {
+	if l.MaxWidth > 0 && width > l.MaxWidth {
+		return errors.Wrapf(ErrDimensionsExceeded, "width %d exceeds %d", width, l.MaxWidth)
+	}
+	if l.MaxHeight > 0 && height > l.MaxHeight {
+		return errors.Wrapf(ErrDimensionsExceeded, "height %d exceeds %d", height, l.MaxHeight)
+	}
+	if pixels := int64(width) * int64(height); l.MaxPixels > 0 && pixels > l.MaxPixels {
+		return errors.Wrapf(ErrDimensionsExceeded, "%d pixels exceed %d", pixels, l.MaxPixels)
+	}
+	return nil
+}
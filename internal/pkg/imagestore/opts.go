@@ -0,0 +1,103 @@
+package imagestore
+
+import (
+	"net"
+	"net/http"
+	"time"
+)
+
+type HTTPOption func(*HTTPStore)
+
+// WithMaxBodySize limits the size of the upstream response body in bytes.
+func WithMaxBodySize(size int64) HTTPOption {
+	return func(s *HTTPStore) {
+		s.maxBodySize = size
+	}
+}
+
+// WithDialTimeout limits the time to establish a TCP connection.
+func WithDialTimeout(timeout time.Duration) HTTPOption {
+	return func(s *HTTPStore) {
+		s.transport.dialTimeout = timeout
+	}
+}
+
+// WithTLSHandshakeTimeout limits the time of the TLS handshake.
+func WithTLSHandshakeTimeout(timeout time.Duration) HTTPOption {
+	return func(s *HTTPStore) {
+		s.transport.tlsHandshakeTimeout = timeout
+	}
+}
+
+// WithResponseHeaderTimeout limits the time to wait for the response headers once the request is sent.
+func WithResponseHeaderTimeout(timeout time.Duration) HTTPOption {
+	return func(s *HTTPStore) {
+		s.transport.responseHeaderTimeout = timeout
+	}
+}
+
+// WithMaxIdleConnsPerHost sets the number of keep-alive connections kept per upstream host.
+func WithMaxIdleConnsPerHost(n int) HTTPOption {
+	return func(s *HTTPStore) {
+		s.transport.maxIdleConnsPerHost = n
+	}
+}
+
+// WithTimeout limits the total time of fetching an image including retries.
+func WithTimeout(timeout time.Duration) HTTPOption {
+	return func(s *HTTPStore) {
+		s.timeout = timeout
+	}
+}
+
+// WithRetries sets how many times 5xx responses and network errors are retried.
+func WithRetries(retries int) HTTPOption {
+	return func(s *HTTPStore) {
+		s.retries = retries
+	}
+}
+
+// WithRetryDelay sets the bounds of the delay between retries.
+// It grows exponentially from baseDelay up to maxDelay, each one is randomized.
+func WithRetryDelay(baseDelay, maxDelay time.Duration) HTTPOption {
+	return func(s *HTTPStore) {
+		s.retryBaseDelay = baseDelay
+		s.retryMaxDelay = maxDelay
+	}
+}
+
+func WithUserAgent(userAgent string) HTTPOption {
+	return func(s *HTTPStore) {
+		s.userAgent = userAgent
+	}
+}
+
+// WithOriginHeaders adds static headers to requests to the host, e.g. credentials of a private origin.
+func WithOriginHeaders(host string, header http.Header) HTTPOption {
+	return func(s *HTTPStore) {
+		if s.originHeaders == nil {
+			s.originHeaders = make(map[string]http.Header)
+		}
+		s.originHeaders[host] = header
+	}
+}
+
+// WithAllowedHosts restricts upstream hosts to the glob patterns, e.g. "*.example.com".
+func WithAllowedHosts(patterns ...string) HTTPOption {
+	return func(s *HTTPStore) {
+		s.guard.allowedHosts = patterns
+	}
+}
+
+// WithDeniedNetworks replaces the networks upstream addresses must not belong to.
+func WithDeniedNetworks(networks ...*net.IPNet) HTTPOption {
+	return func(s *HTTPStore) {
+		s.guard.deniedNetworks = networks
+	}
+}
+
+func WithMaxRedirects(n int) HTTPOption {
+	return func(s *HTTPStore) {
+		s.guard.maxRedirects = n
+	}
+}
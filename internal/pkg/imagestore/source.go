@@ -0,0 +1,31 @@
+package imagestore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+)
+
+// Source is an image as it is stored, before decoding.
+type Source struct {
+	ContentType string
+	ETag        string // identifies the version of the image
+	Data        []byte
+}
+
+// contentETag identifies the data by its hash when there is no better validator.
+func contentETag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// responseETag prefers the upstream validators over the content hash.
+func responseETag(header http.Header, data []byte) string {
+	if etag := header.Get("ETag"); etag != "" {
+		return "etag:" + etag
+	}
+	if lastModified := header.Get("Last-Modified"); lastModified != "" {
+		return "last-modified:" + lastModified
+	}
+	return contentETag(data)
+}
@@ -0,0 +1,120 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+)
+
+var exifHeader = []byte("Exif\x00\x00")
+
+const (
+	tagOrientation = 0x0112
+	tagCopyright   = 0x8298
+
+	typeASCII = 2
+	typeShort = 3
+)
+
+// exif is the TIFF structure of an EXIF segment.
+type exif struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+func parseExif(payload []byte) (exif, bool) {
+	if !bytes.HasPrefix(payload, exifHeader) {
+		return exif{}, false
+	}
+	data := payload[len(exifHeader):]
+	if len(data) < 8 {
+		return exif{}, false
+	}
+
+	var order binary.ByteOrder
+	switch string(data[:4]) {
+	case "II*\x00":
+		order = binary.LittleEndian
+	case "MM\x00*":
+		order = binary.BigEndian
+	default:
+		return exif{}, false
+	}
+	return exif{data: data, order: order}, true
+}
+
+// entry returns the type, count and value field of the tag in IFD0.
+func (e exif) entry(tag uint16) (uint16, uint32, []byte, bool) {
+	offset := e.order.Uint32(e.data[4:8])
+	if uint64(offset)+2 > uint64(len(e.data)) {
+		return 0, 0, nil, false
+	}
+
+	count := int(e.order.Uint16(e.data[offset:]))
+	entries := e.data[offset+2:]
+	for i := 0; i < count && (i+1)*12 <= len(entries); i++ {
+		entry := entries[i*12 : (i+1)*12]
+		if e.order.Uint16(entry) == tag {
+			return e.order.Uint16(entry[2:]), e.order.Uint32(entry[4:]), entry[8:12], true
+		}
+	}
+	return 0, 0, nil, false
+}
+
+func (e exif) orientation() (int, bool) {
+	typ, count, value, ok := e.entry(tagOrientation)
+	if !ok || typ != typeShort || count != 1 {
+		return 0, false
+	}
+	return int(e.order.Uint16(value)), true
+}
+
+func (e exif) copyright() (string, bool) {
+	typ, count, value, ok := e.entry(tagCopyright)
+	if !ok || typ != typeASCII {
+		return "", false
+	}
+
+	data := value
+	if count > 4 {
+		offset := e.order.Uint32(value)
+		if uint64(offset)+uint64(count) > uint64(len(e.data)) {
+			return "", false
+		}
+		data = e.data[offset : offset+count]
+	} else {
+		data = data[:count]
+	}
+
+	// the photographer and editor notices are separated by NUL
+	s := strings.TrimRight(strings.Replace(string(data), "\x00", " ", -1), " ")
+	return s, s != ""
+}
+
+// buildExif returns an EXIF segment payload with the copyright only.
+func buildExif(copyright string) []byte {
+	const ifdOffset = 8
+	value := append([]byte(copyright), 0)
+
+	buf := &bytes.Buffer{}
+	buf.Write(exifHeader)
+	buf.WriteString("MM\x00*")
+	binary.Write(buf, binary.BigEndian, uint32(ifdOffset))
+
+	// one entry followed by the offset of the next IFD
+	binary.Write(buf, binary.BigEndian, uint16(1))
+	binary.Write(buf, binary.BigEndian, uint16(tagCopyright))
+	binary.Write(buf, binary.BigEndian, uint16(typeASCII))
+	binary.Write(buf, binary.BigEndian, uint32(len(value)))
+	if len(value) <= 4 {
+		inline := make([]byte, 4)
+		copy(inline, value)
+		buf.Write(inline)
+		binary.Write(buf, binary.BigEndian, uint32(0))
+		return buf.Bytes()
+	}
+	binary.Write(buf, binary.BigEndian, uint32(ifdOffset+2+12+4))
+	binary.Write(buf, binary.BigEndian, uint32(0))
+	buf.Write(value)
+	return buf.Bytes()
+}
@@ -0,0 +1,163 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	markerSOI  = 0xd8
+	markerEOI  = 0xd9
+	markerSOS  = 0xda
+	markerAPP1 = 0xe1
+	markerAPP2 = 0xe2
+
+	// maxSegmentSize is the payload limit of a segment, its length field counts itself
+	maxSegmentSize = 0xffff - 2
+)
+
+var iccHeader = []byte("ICC_PROFILE\x00")
+
+type segment struct {
+	marker  byte
+	payload []byte
+}
+
+type segments []segment
+
+// jpegSegments returns the segments preceding the image data.
+func jpegSegments(data []byte) segments {
+	if len(data) < 2 || data[0] != 0xff || data[1] != markerSOI {
+		return nil
+	}
+
+	var result segments
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xff {
+			return result
+		}
+		marker := data[i+1]
+		if marker == 0xff {
+			// fill byte
+			i++
+			continue
+		}
+		if marker == markerSOS || marker == markerEOI {
+			return result
+		}
+		if marker == 0x01 || (marker >= 0xd0 && marker <= 0xd7) {
+			// standalone markers
+			i += 2
+			continue
+		}
+
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			return result
+		}
+		result = append(result, segment{marker: marker, payload: data[i+4 : i+2+length]})
+		i += 2 + length
+	}
+	return result
+}
+
+func (s segments) exif() (exif, bool) {
+	for _, seg := range s {
+		if seg.marker == markerAPP1 {
+			if e, ok := parseExif(seg.payload); ok {
+				return e, true
+			}
+		}
+	}
+	return exif{}, false
+}
+
+// iccProfile reassembles the profile which may be split into several chunks.
+func (s segments) iccProfile() []byte {
+	type chunk struct {
+		seq  int
+		data []byte
+	}
+
+	var (
+		chunks []chunk
+		total  int
+	)
+	for _, seg := range s {
+		if seg.marker != markerAPP2 || !bytes.HasPrefix(seg.payload, iccHeader) || len(seg.payload) < len(iccHeader)+2 {
+			continue
+		}
+		header := seg.payload[len(iccHeader):]
+		chunks = append(chunks, chunk{seq: int(header[0]), data: header[2:]})
+		total = int(header[1])
+	}
+	if len(chunks) == 0 || len(chunks) != total {
+		return nil
+	}
+
+	sort.Slice(chunks, func(i, j int) bool { return chunks[i].seq < chunks[j].seq })
+	var profile []byte
+	for i, c := range chunks {
+		if c.seq != i+1 {
+			return nil
+		}
+		profile = append(profile, c.data...)
+	}
+	if len(profile) > MaxICCProfileSize {
+		return nil
+	}
+	return profile
+}
+
+func readJPEG(data []byte) Metadata {
+	segs := jpegSegments(data)
+
+	m := Metadata{ICCProfile: segs.iccProfile()}
+	if e, ok := segs.exif(); ok {
+		m.Copyright, _ = e.copyright()
+	}
+	return m
+}
+
+// embedJPEG inserts the EXIF and ICC segments right after the start of image.
+func embedJPEG(data []byte, m Metadata) ([]byte, error) {
+	if len(data) < 2 || data[0] != 0xff || data[1] != markerSOI {
+		return nil, errors.New("not a jpeg image")
+	}
+
+	var segs []segment
+	if m.Copyright != "" {
+		payload := buildExif(m.Copyright)
+		if len(payload) > maxSegmentSize {
+			return nil, errors.New("copyright is too long")
+		}
+		segs = append(segs, segment{marker: markerAPP1, payload: payload})
+	}
+
+	const chunkSize = maxSegmentSize - 14 // ICC header, sequence number and count
+	count := (len(m.ICCProfile) + chunkSize - 1) / chunkSize
+	if count > 255 {
+		return nil, errors.New("icc profile is too large")
+	}
+	for i := 0; i < count; i++ {
+		chunk := m.ICCProfile[i*chunkSize:]
+		if len(chunk) > chunkSize {
+			chunk = chunk[:chunkSize]
+		}
+		payload := append(append([]byte{}, iccHeader...), byte(i+1), byte(count))
+		segs = append(segs, segment{marker: markerAPP2, payload: append(payload, chunk...)})
+	}
+
+	buf := &bytes.Buffer{}
+	buf.Write(data[:2])
+	for _, seg := range segs {
+		buf.Write([]byte{0xff, seg.marker})
+		binary.Write(buf, binary.BigEndian, uint16(len(seg.payload)+2))
+		buf.Write(seg.payload)
+	}
+	buf.Write(data[2:])
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,81 @@
+// Package metadata reads and writes the image metadata which survives transformations.
+//
+// Outputs are encoded without any metadata, so location and camera details never leak.
+// Only the ICC profile, needed to render colors right, and the copyright notice may be
+// carried over on request. They are written into freshly built segments, nothing else
+// of the source metadata is copied.
+package metadata
+
+import "github.com/ivanovaleksey/resizer/internal/pkg/format"
+
+// MaxICCProfileSize is the size of the largest ICC profile which is carried over,
+// real profiles are well below it. Larger ones are dropped.
+const MaxICCProfileSize = 4 << 20
+
+// Metadata is what may be preserved from the source image.
+type Metadata struct {
+	ICCProfile []byte
+	Copyright  string
+}
+
+func (m Metadata) Empty() bool {
+	return len(m.ICCProfile) == 0 && m.Copyright == ""
+}
+
+// Orientation values of the EXIF Orientation tag.
+const (
+	OrientationNormal     = 1
+	OrientationFlipH      = 2
+	OrientationRotate180  = 3
+	OrientationFlipV      = 4
+	OrientationTranspose  = 5
+	OrientationRotate90   = 6 // clockwise
+	OrientationTransverse = 7
+	OrientationRotate270  = 8 // clockwise
+)
+
+// Orientation returns the EXIF orientation of a JPEG image, OrientationNormal when it is unknown.
+func Orientation(data []byte, f format.Format) int {
+	if f != format.JPEG {
+		return OrientationNormal
+	}
+
+	exif, ok := jpegSegments(data).exif()
+	if !ok {
+		return OrientationNormal
+	}
+	o, ok := exif.orientation()
+	if !ok || o < OrientationNormal || o > OrientationRotate270 {
+		return OrientationNormal
+	}
+	return o
+}
+
+// Read returns the preservable metadata of a JPEG or PNG image, other formats have none.
+// Malformed metadata is ignored as it doesn't prevent decoding.
+func Read(data []byte, f format.Format) Metadata {
+	switch f {
+	case format.JPEG:
+		return readJPEG(data)
+	case format.PNG:
+		return readPNG(data)
+	default:
+		return Metadata{}
+	}
+}
+
+// Embed adds the metadata to an encoded JPEG or PNG image, other formats are returned as is.
+func Embed(data []byte, f format.Format, m Metadata) ([]byte, error) {
+	if m.Empty() {
+		return data, nil
+	}
+
+	switch f {
+	case format.JPEG:
+		return embedJPEG(data, m)
+	case format.PNG:
+		return embedPNG(data, m)
+	default:
+		return data, nil
+	}
+}
@@ -0,0 +1,142 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ivanovaleksey/resizer/internal/pkg/format"
+)
+
+const gpsLatitude = "GPS 55.7558 N"
+
+func TestJPEG(t *testing.T) {
+	profile := bytes.Repeat([]byte("icc profile "), 10000) // two segments
+	src := jpegData(t)
+	src, err := embedJPEG(src, Metadata{ICCProfile: profile})
+	require.NoError(t, err)
+	src = insertSegment(src, markerAPP1, sourceExif(binary.LittleEndian, OrientationRotate90, "Jane Doe"))
+
+	t.Run("it reads orientation", func(t *testing.T) {
+		assert.Equal(t, OrientationRotate90, Orientation(src, format.JPEG))
+		assert.Equal(t, OrientationNormal, Orientation(jpegData(t), format.JPEG))
+		assert.Equal(t, OrientationNormal, Orientation(src, format.PNG))
+	})
+
+	t.Run("it reads metadata", func(t *testing.T) {
+		m := Read(src, format.JPEG)
+		assert.Equal(t, profile, m.ICCProfile)
+		assert.Equal(t, "Jane Doe", m.Copyright)
+	})
+
+	t.Run("it embeds only preserved metadata", func(t *testing.T) {
+		m := Read(src, format.JPEG)
+		out, err := Embed(jpegData(t), format.JPEG, m)
+		require.NoError(t, err)
+
+		assert.Equal(t, m, Read(out, format.JPEG))
+		assert.Equal(t, OrientationNormal, Orientation(out, format.JPEG))
+		assert.NotContains(t, string(out), gpsLatitude)
+
+		_, err = jpeg.Decode(bytes.NewReader(out))
+		assert.NoError(t, err)
+	})
+
+	t.Run("it reads big endian exif", func(t *testing.T) {
+		src := insertSegment(jpegData(t), markerAPP1, sourceExif(binary.BigEndian, OrientationFlipV, "ACME"))
+		assert.Equal(t, OrientationFlipV, Orientation(src, format.JPEG))
+		assert.Equal(t, "ACME", Read(src, format.JPEG).Copyright)
+	})
+
+	t.Run("it ignores malformed exif", func(t *testing.T) {
+		src := insertSegment(jpegData(t), markerAPP1, []byte("Exif\x00\x00MM\x00*\xff\xff\xff\xff"))
+		assert.Equal(t, OrientationNormal, Orientation(src, format.JPEG))
+		assert.Equal(t, Metadata{}, Read(src, format.JPEG))
+	})
+}
+
+func TestPNG(t *testing.T) {
+	buf := &bytes.Buffer{}
+	require.NoError(t, png.Encode(buf, image.NewRGBA(image.Rect(0, 0, 4, 4))))
+
+	m := Metadata{ICCProfile: []byte("icc profile"), Copyright: "© Jane Doe"}
+	out, err := Embed(buf.Bytes(), format.PNG, m)
+	require.NoError(t, err)
+	assert.Equal(t, m, Read(out, format.PNG))
+
+	_, err = png.Decode(bytes.NewReader(out))
+	assert.NoError(t, err)
+
+	t.Run("it drops oversized profiles", func(t *testing.T) {
+		out, err := Embed(buf.Bytes(), format.PNG, Metadata{ICCProfile: make([]byte, MaxICCProfileSize+1)})
+		require.NoError(t, err)
+		assert.Less(t, len(out), 64<<10)
+		assert.Equal(t, Metadata{}, Read(out, format.PNG))
+	})
+}
+
+func TestEmbed(t *testing.T) {
+	data := []byte("GIF89a")
+	out, err := Embed(data, format.GIF, Metadata{Copyright: "Jane Doe"})
+	require.NoError(t, err)
+	assert.Equal(t, data, out)
+
+	_, err = Embed(data, format.JPEG, Metadata{Copyright: "Jane Doe"})
+	assert.Error(t, err)
+}
+
+func jpegData(t *testing.T) []byte {
+	buf := &bytes.Buffer{}
+	require.NoError(t, jpeg.Encode(buf, image.NewGray(image.Rect(0, 0, 8, 8)), nil))
+	return buf.Bytes()
+}
+
+func insertSegment(data []byte, marker byte, payload []byte) []byte {
+	out := append([]byte{}, data[:2]...)
+	out = append(out, 0xff, marker, byte((len(payload)+2)>>8), byte(len(payload)+2))
+	out = append(out, payload...)
+	return append(out, data[2:]...)
+}
+
+// sourceExif returns an EXIF segment with orientation, copyright and a GPS IFD.
+func sourceExif(order binary.ByteOrder, orientation int, copyright string) []byte {
+	const (
+		ifdOffset = 8
+		entries   = 3
+		dataStart = ifdOffset + 2 + entries*12 + 4
+		tagGPS    = 0x8825
+	)
+	copyrightValue := append([]byte(copyright), 0)
+	gpsOffset := dataStart + len(copyrightValue)
+
+	buf := &bytes.Buffer{}
+	buf.Write(exifHeader)
+	if order == binary.LittleEndian {
+		buf.WriteString("II*\x00")
+	} else {
+		buf.WriteString("MM\x00*")
+	}
+	binary.Write(buf, order, uint32(ifdOffset))
+	binary.Write(buf, order, uint16(entries))
+
+	binary.Write(buf, order, []uint16{tagOrientation, typeShort})
+	binary.Write(buf, order, uint32(1))
+	binary.Write(buf, order, []uint16{uint16(orientation), 0})
+
+	binary.Write(buf, order, []uint16{tagCopyright, typeASCII})
+	binary.Write(buf, order, []uint32{uint32(len(copyrightValue)), dataStart})
+
+	binary.Write(buf, order, []uint16{tagGPS, 4})
+	binary.Write(buf, order, []uint32{1, uint32(gpsOffset)})
+
+	binary.Write(buf, order, uint32(0))
+	buf.Write(copyrightValue)
+	buf.WriteString(gpsLatitude)
+	return buf.Bytes()
+}
@@ -0,0 +1,148 @@
+package metadata
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	pngSignature = "\x89PNG\r\n\x1a\n"
+
+	copyrightKeyword = "Copyright"
+	iccProfileName   = "ICC Profile"
+)
+
+type chunk struct {
+	typ  string
+	data []byte
+}
+
+// pngChunks returns the chunks of the image, stopping at the first malformed one.
+func pngChunks(data []byte) []chunk {
+	if !bytes.HasPrefix(data, []byte(pngSignature)) {
+		return nil
+	}
+
+	var result []chunk
+	for i := len(pngSignature); i+12 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		if length < 0 || i+12+length > len(data) {
+			return result
+		}
+		result = append(result, chunk{typ: string(data[i+4 : i+8]), data: data[i+8 : i+8+length]})
+		i += 12 + length
+	}
+	return result
+}
+
+func readPNG(data []byte) Metadata {
+	var m Metadata
+	for _, c := range pngChunks(data) {
+		switch c.typ {
+		case "iCCP":
+			m.ICCProfile = readICCP(c.data)
+		case "tEXt":
+			if parts := bytes.SplitN(c.data, []byte{0}, 2); len(parts) == 2 && string(parts[0]) == copyrightKeyword {
+				m.Copyright = latin1(parts[1])
+			}
+		case "iTXt":
+			if text, ok := readITXt(c.data, copyrightKeyword); ok {
+				m.Copyright = text
+			}
+		}
+	}
+	return m
+}
+
+// readICCP returns the profile of an iCCP chunk: name, NUL, compression method and zlib data.
+func readICCP(data []byte) []byte {
+	i := bytes.IndexByte(data, 0)
+	if i < 0 || i+2 > len(data) || data[i+1] != 0 {
+		return nil
+	}
+
+	r, err := zlib.NewReader(bytes.NewReader(data[i+2:]))
+	if err != nil {
+		return nil
+	}
+	defer r.Close()
+
+	// a tiny chunk may inflate to gigabytes
+	profile, err := ioutil.ReadAll(io.LimitReader(r, MaxICCProfileSize+1))
+	if err != nil || len(profile) > MaxICCProfileSize {
+		return nil
+	}
+	return profile
+}
+
+// readITXt returns the uncompressed text of the keyword:
+// keyword, NUL, compression flag and method, language, NUL, translated keyword, NUL, text.
+func readITXt(data []byte, keyword string) (string, bool) {
+	parts := bytes.SplitN(data, []byte{0}, 2)
+	if len(parts) != 2 || string(parts[0]) != keyword || len(parts[1]) < 2 || parts[1][0] != 0 {
+		return "", false
+	}
+
+	rest := bytes.SplitN(parts[1][2:], []byte{0}, 3)
+	if len(rest) != 3 {
+		return "", false
+	}
+	return string(rest[2]), true
+}
+
+func latin1(data []byte) string {
+	runes := make([]rune, len(data))
+	for i, b := range data {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+
+// embedPNG inserts the iCCP and iTXt chunks right after the header chunk,
+// iCCP must precede the image data.
+func embedPNG(data []byte, m Metadata) ([]byte, error) {
+	const headerEnd = len(pngSignature) + 12 + 13 // signature and IHDR chunk
+	if len(data) < headerEnd || !bytes.HasPrefix(data, []byte(pngSignature)) || string(data[12:16]) != "IHDR" {
+		return nil, errors.New("not a png image")
+	}
+
+	buf := &bytes.Buffer{}
+	buf.Write(data[:headerEnd])
+
+	if len(m.ICCProfile) > 0 {
+		compressed := &bytes.Buffer{}
+		w := zlib.NewWriter(compressed)
+		if _, err := w.Write(m.ICCProfile); err != nil {
+			return nil, errors.Wrap(err, "can't compress icc profile")
+		}
+		if err := w.Close(); err != nil {
+			return nil, errors.Wrap(err, "can't compress icc profile")
+		}
+		writeChunk(buf, "iCCP", append([]byte(iccProfileName+"\x00\x00"), compressed.Bytes()...))
+	}
+
+	if m.Copyright != "" {
+		// uncompressed UTF-8 text without language and translated keyword
+		writeChunk(buf, "iTXt", []byte(copyrightKeyword+"\x00\x00\x00\x00\x00"+m.Copyright))
+	}
+
+	buf.Write(data[headerEnd:])
+	return buf.Bytes(), nil
+}
+
+func writeChunk(buf *bytes.Buffer, typ string, data []byte) {
+	binary.Write(buf, binary.BigEndian, uint32(len(data)))
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(typ))
+	crc.Write(data)
+
+	buf.WriteString(typ)
+	buf.Write(data)
+	binary.Write(buf, binary.BigEndian, crc.Sum32())
+}
@@ -0,0 +1,80 @@
+// Package preset loads named transformations from a config file,
+// so clients request "card" instead of spelling out its params.
+package preset
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// Preset mirrors the query parameters of a resize request, zero values mean the defaults.
+type Preset struct {
+	Width       int      `yaml:"width" json:"width"`
+	Height      int      `yaml:"height" json:"height"`
+	Mode        string   `yaml:"mode" json:"mode"`
+	Gravity     string   `yaml:"gravity" json:"gravity"`
+	FocalPointX *float64 `yaml:"fp-x" json:"fp-x"`
+	FocalPointY *float64 `yaml:"fp-y" json:"fp-y"`
+	Format      string   `yaml:"format" json:"format"`
+	Quality     int      `yaml:"quality" json:"quality"`
+	Compression string   `yaml:"compression" json:"compression"`
+	Ops         string   `yaml:"ops" json:"ops"`
+	Metadata    string   `yaml:"metadata" json:"metadata"`
+}
+
+// Presets are presets by name.
+type Presets map[string]Preset
+
+// Load reads presets from a JSON file when it has the .json extension and from a YAML one otherwise.
+// Unknown fields are rejected, so typos don't silently change transformations.
+func Load(path string) (Presets, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't read presets")
+	}
+
+	var presets Presets
+	if filepath.Ext(path) == ".json" {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(&presets)
+	} else {
+		err = yaml.UnmarshalStrict(data, &presets)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't parse presets %s", path)
+	}
+	return presets, nil
+}
+
+// Store holds presets which may be replaced while they are being read.
+type Store struct {
+	mu      sync.RWMutex
+	presets Presets
+}
+
+func NewStore() *Store {
+	return &Store{}
+}
+
+func (s *Store) Get(name string) (Preset, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	p, ok := s.presets[name]
+	return p, ok
+}
+
+// Replace swaps all presets at once.
+func (s *Store) Replace(presets Presets) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.presets = presets
+}
@@ -0,0 +1,78 @@
+package preset
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "presets")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	write := func(name, data string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, ioutil.WriteFile(path, []byte(data), 0600))
+		return path
+	}
+
+	fpX := 0.3
+	expected := Presets{
+		"thumb": {Width: 320, Height: 240, Mode: "fill"},
+		"hero":  {Width: 1920, Gravity: "fp", FocalPointX: &fpX, Ops: "sharpen:0.5"},
+	}
+
+	t.Run("it loads yaml", func(t *testing.T) {
+		presets, err := Load(write("presets.yaml", `
+thumb:
+  width: 320
+  height: 240
+  mode: fill
+hero:
+  width: 1920
+  gravity: fp
+  fp-x: 0.3
+  ops: sharpen:0.5
+`))
+		require.NoError(t, err)
+		assert.Equal(t, expected, presets)
+	})
+
+	t.Run("it loads json", func(t *testing.T) {
+		presets, err := Load(write("presets.json", `{
+	"thumb": {"width": 320, "height": 240, "mode": "fill"},
+	"hero": {"width": 1920, "gravity": "fp", "fp-x": 0.3, "ops": "sharpen:0.5"}
+}`))
+		require.NoError(t, err)
+		assert.Equal(t, expected, presets)
+	})
+
+	t.Run("it rejects unknown fields", func(t *testing.T) {
+		_, err := Load(write("typo.yaml", "thumb:\n  widht: 320\n"))
+		assert.Error(t, err)
+
+		_, err = Load(write("typo.json", `{"thumb": {"widht": 320}}`))
+		assert.Error(t, err)
+	})
+
+	t.Run("it fails on missing file", func(t *testing.T) {
+		_, err := Load(filepath.Join(dir, "missing.yaml"))
+		assert.Error(t, err)
+	})
+}
+
+func TestStore(t *testing.T) {
+	store := NewStore()
+	_, ok := store.Get("thumb")
+	assert.False(t, ok)
+
+	store.Replace(Presets{"thumb": {Width: 320}})
+	p, ok := store.Get("thumb")
+	require.True(t, ok)
+	assert.Equal(t, 320, p.Width)
+}
@@ -3,18 +3,32 @@ package resizer
 import (
 	"context"
 	"image"
+
+	"github.com/ivanovaleksey/resizer/internal/pkg/cache"
+	"github.com/ivanovaleksey/resizer/internal/pkg/imagestore"
 )
 
 type dummyImageProvider struct {
 }
 
-func (d dummyImageProvider) GetImage(ctx context.Context, target string) (image.Image, error) {
-	return nil, nil
+func (d dummyImageProvider) GetImage(ctx context.Context, target string) (imagestore.Source, error) {
+	return imagestore.Source{}, nil
 }
 
 type dummyResizer struct {
 }
 
-func (d dummyResizer) Resize(image.Image, Params) (image.Image, error) {
+func (d dummyResizer) Resize(context.Context, image.Image, Params) (image.Image, error) {
 	return nil, nil
 }
+
+type dummyCacheProvider struct {
+}
+
+func (d dummyCacheProvider) Get(cache.Entity) (cache.Item, error) {
+	return cache.Item{}, cache.ErrCacheMiss
+}
+
+func (d dummyCacheProvider) Set(cache.Entity, cache.Item) error {
+	return nil
+}
@@ -0,0 +1,20 @@
+package resizer
+
+import "github.com/pkg/errors"
+
+const (
+	ErrInvalidParams = Error("invalid params")
+	// ErrOverloaded means there is no free worker to process the image in time, retry later.
+	ErrOverloaded = Error("service is overloaded")
+)
+
+type Error string
+
+func (e Error) Error() string {
+	return string(e)
+}
+
+// invalidParams annotates ErrInvalidParams with the reason, errors.Cause returns ErrInvalidParams.
+func invalidParams(format string, args ...interface{}) error {
+	return errors.Wrapf(ErrInvalidParams, format, args...)
+}
@@ -0,0 +1,118 @@
+package resizer
+
+import (
+	"context"
+	"image"
+	"math"
+
+	"github.com/disintegration/imaging"
+	"github.com/pkg/errors"
+)
+
+// Gravity defines which part of the image is kept when it is cropped.
+type Gravity string
+
+const (
+	GravityCenter     Gravity = "center"
+	GravityNorth      Gravity = "north"
+	GravitySouth      Gravity = "south"
+	GravityEast       Gravity = "east"
+	GravityWest       Gravity = "west"
+	GravityNorthEast  Gravity = "northeast"
+	GravityNorthWest  Gravity = "northwest"
+	GravitySouthEast  Gravity = "southeast"
+	GravitySouthWest  Gravity = "southwest"
+	GravityFocalPoint Gravity = "fp"
+	GravitySmart      Gravity = "smart"
+)
+
+// anchors are the points fixed gravities keep in the crop.
+var anchors = map[Gravity]FocalPoint{
+	GravityCenter:    {X: 0.5, Y: 0.5},
+	GravityNorth:     {X: 0.5, Y: 0},
+	GravitySouth:     {X: 0.5, Y: 1},
+	GravityEast:      {X: 1, Y: 0.5},
+	GravityWest:      {X: 0, Y: 0.5},
+	GravityNorthEast: {X: 1, Y: 0},
+	GravityNorthWest: {X: 0, Y: 0},
+	GravitySouthEast: {X: 1, Y: 1},
+	GravitySouthWest: {X: 0, Y: 1},
+}
+
+func ParseGravity(s string) (Gravity, error) {
+	gravity := Gravity(s)
+	if gravity == "" {
+		return GravityCenter, nil
+	}
+	if _, ok := anchors[gravity]; ok || gravity == GravityFocalPoint || gravity == GravitySmart {
+		return gravity, nil
+	}
+	return "", errors.Errorf("unknown gravity %q", s)
+}
+
+// FocalPoint is a point of interest given as fractions of the image width and height.
+type FocalPoint struct {
+	X float64
+	Y float64
+}
+
+func (fp FocalPoint) Validate() error {
+	// NaN fails every comparison, so it has to be rejected on its own
+	if math.IsNaN(fp.X) || math.IsNaN(fp.Y) || math.IsInf(fp.X, 0) || math.IsInf(fp.Y, 0) {
+		return errors.New("focal point is not a number")
+	}
+	if fp.X < 0 || fp.X > 1 || fp.Y < 0 || fp.Y > 1 {
+		return errors.New("focal point is out of range [0, 1]")
+	}
+	return nil
+}
+
+// fill crops the largest region with the target aspect ratio around the anchor or focal point
+// and scales it to the exact size.
+func fill(ctx context.Context, img image.Image, params Params) (*image.NRGBA, error) {
+	fp := params.FocalPoint
+	if params.Gravity != GravityFocalPoint {
+		anchor, ok := anchors[params.Gravity]
+		if !ok {
+			anchor = anchors[GravityCenter]
+		}
+		fp = anchor
+	}
+
+	crop := focalCrop(img.Bounds(), params.Width, params.Height, fp)
+	return resample(ctx, imaging.Crop(img, crop), params.Width, params.Height)
+}
+
+// focalCrop returns the largest rectangle with the target aspect ratio
+// centered at the focal point as close as the image bounds allow.
+func focalCrop(bounds image.Rectangle, width, height int, fp FocalPoint) image.Rectangle {
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+	cropW, cropH := srcW, srcH
+	if float64(srcW)*float64(height) > float64(srcH)*float64(width) {
+		cropW = maxInt(1, int(float64(srcH)*float64(width)/float64(height)+0.5))
+	} else {
+		cropH = maxInt(1, int(float64(srcW)*float64(height)/float64(width)+0.5))
+	}
+
+	x := clampInt(int(fp.X*float64(srcW))-cropW/2, 0, srcW-cropW)
+	y := clampInt(int(fp.Y*float64(srcH))-cropH/2, 0, srcH-cropH)
+
+	return image.Rect(x, y, x+cropW, y+cropH).Add(bounds.Min)
+}
+
+func clampInt(x, min, max int) int {
+	if x < min {
+		return min
+	}
+	if x > max {
+		return max
+	}
+	return x
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
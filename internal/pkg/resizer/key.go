@@ -0,0 +1,90 @@
+package resizer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ivanovaleksey/resizer/internal/pkg/encoder"
+	"github.com/ivanovaleksey/resizer/internal/pkg/imagestore"
+)
+
+// Key returns the canonical form of params: equal transformations
+// produce equal keys no matter how defaults were spelled in the request.
+func (p Params) Key() string {
+	mode, _ := ParseMode(string(p.Mode))
+	gravity, _ := ParseGravity(string(p.Gravity))
+
+	parts := []string{
+		"w:" + strconv.Itoa(p.Width),
+		"h:" + strconv.Itoa(p.Height),
+		"m:" + string(mode),
+		"g:" + string(gravity),
+	}
+	if gravity == GravityFocalPoint {
+		parts = append(parts, "fp:"+formatFloat(p.FocalPoint.X)+":"+formatFloat(p.FocalPoint.Y))
+	}
+
+	if p.Format != "" {
+		parts = append(parts, "f:"+string(p.Format))
+	} else {
+		// the format is picked once transparency is known, clients accepting different
+		// lists which negotiate the same formats share results
+		opaque := encoder.Negotiate(p.Accept, false)
+		alpha := encoder.Negotiate(p.Accept, true)
+		parts = append(parts, "f:auto:"+string(opaque)+":"+string(alpha))
+	}
+
+	parts = append(parts,
+		"q:"+strconv.Itoa(p.Encoding.Quality),
+		"c:"+strconv.Itoa(int(p.Encoding.Compression)),
+	)
+	if len(p.Ops) > 0 {
+		parts = append(parts, "ops:"+p.Ops.String())
+	}
+	if p.KeepMetadata {
+		parts = append(parts, "md:keep")
+	}
+
+	return strings.Join(parts, "/")
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// sources are the images a result is made of: the target and the ones operations load.
+type sources struct {
+	main   imagestore.Source
+	loaded map[string]imagestore.Source
+}
+
+// version identifies the versions of all the sources.
+func (s sources) version() string {
+	targets := make([]string, 0, len(s.loaded))
+	for target := range s.loaded {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+
+	parts := []string{s.main.ETag}
+	for _, target := range targets {
+		parts = append(parts, target+"="+s.loaded[target].ETag)
+	}
+	return strings.Join(parts, "\n")
+}
+
+// resultKey identifies the result of transforming the version of the target with params,
+// so results of a changed source or overlay are never served from the cache.
+func resultKey(target, version string, params Params) string {
+	sum := sha256.Sum256([]byte(target + "\n" + version + "\n" + params.Key()))
+	return hex.EncodeToString(sum[:])
+}
+
+// resultETag is a strong validator of the result, it changes whenever the version or params do.
+func resultETag(version string, params Params) string {
+	sum := sha256.Sum256([]byte(version + "\n" + params.Key()))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
@@ -0,0 +1,61 @@
+package resizer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ivanovaleksey/resizer/internal/pkg/format"
+	"github.com/ivanovaleksey/resizer/internal/pkg/imagestore"
+)
+
+func TestParams_Key(t *testing.T) {
+	t.Run("it ignores spelling of defaults", func(t *testing.T) {
+		implicit := Params{Width: 100, FocalPoint: FocalPoint{X: 0.3}}
+		explicit := Params{Width: 100, Mode: ModeStretch, Gravity: GravityCenter}
+		assert.Equal(t, explicit.Key(), implicit.Key())
+	})
+
+	t.Run("it ignores accepted formats which are never picked", func(t *testing.T) {
+		all := Params{Width: 100, Accept: []format.Format{format.PNG, format.JPEG, format.GIF}}
+		reordered := Params{Width: 100, Accept: []format.Format{format.GIF, format.JPEG, format.PNG}}
+		assert.Equal(t, all.Key(), reordered.Key())
+
+		jpegOnly := Params{Width: 100, Accept: []format.Format{format.JPEG}}
+		assert.Equal(t, Params{Width: 100}.Key(), jpegOnly.Key())
+
+		// transparent results are GIF rather than PNG
+		gifOnly := Params{Width: 100, Accept: []format.Format{format.GIF}}
+		assert.NotEqual(t, jpegOnly.Key(), gifOnly.Key())
+	})
+
+	t.Run("it differs for different params", func(t *testing.T) {
+		base := Params{Width: 100, Height: 100, Mode: ModeFill, Format: format.JPEG}
+		variants := []Params{base, base, base, base, base}
+		variants[1].Gravity = GravityNorth
+		variants[2].Encoding.Quality = 90
+		variants[3].Format = ""
+		variants[4].Format, variants[4].Accept = "", []format.Format{format.PNG}
+
+		keys := make(map[string]bool)
+		for _, p := range variants {
+			keys[resultKey("http://example.com/1.jpg", `"v1"`, p)] = true
+		}
+		assert.Len(t, keys, len(variants))
+	})
+
+	t.Run("it differs for different versions of the source", func(t *testing.T) {
+		params := Params{Width: 100}
+		v1 := resultKey("http://example.com/1.jpg", `"v1"`, params)
+		v2 := resultKey("http://example.com/1.jpg", `"v2"`, params)
+		assert.NotEqual(t, v1, v2)
+	})
+
+	t.Run("it includes versions of loaded images", func(t *testing.T) {
+		src := imagestore.Source{ETag: `"v1"`}
+		v1 := sources{main: src, loaded: map[string]imagestore.Source{"a.png": {ETag: `"a1"`}, "b.png": {ETag: `"b1"`}}}
+		v2 := sources{main: src, loaded: map[string]imagestore.Source{"a.png": {ETag: `"a2"`}, "b.png": {ETag: `"b1"`}}}
+		assert.NotEqual(t, v1.version(), v2.version())
+		assert.Equal(t, v1.version(), sources{main: src, loaded: map[string]imagestore.Source{"b.png": {ETag: `"b1"`}, "a.png": {ETag: `"a1"`}}}.version())
+	})
+}
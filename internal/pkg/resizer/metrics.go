@@ -0,0 +1,28 @@
+package resizer
+
+import (
+	"context"
+	"expvar"
+)
+
+// metrics are published as "resizer" at /debug/vars.
+var metrics = expvar.NewMap("resizer")
+
+const (
+	metricCompleted = "completed"
+	metricAborted   = "aborted"
+	metricFailed    = "failed"
+)
+
+// countWork records the outcome of processing an image.
+// Work stopped because nobody waits for it anymore is aborted.
+func countWork(err error) {
+	switch err {
+	case nil:
+		metrics.Add(metricCompleted, 1)
+	case context.Canceled, context.DeadlineExceeded:
+		metrics.Add(metricAborted, 1)
+	default:
+		metrics.Add(metricFailed, 1)
+	}
+}
@@ -3,7 +3,7 @@
 package mocks
 
 import context "context"
-import image "image"
+import imagestore "github.com/ivanovaleksey/resizer/internal/pkg/imagestore"
 import mock "github.com/stretchr/testify/mock"
 
 // ImageProvider is an autogenerated mock type for the ImageProvider type
@@ -12,16 +12,14 @@ type ImageProvider struct {
 }
 
 // GetImage provides a mock function with given fields: ctx, target
-func (_m *ImageProvider) GetImage(ctx context.Context, target string) (image.Image, error) {
+func (_m *ImageProvider) GetImage(ctx context.Context, target string) (imagestore.Source, error) {
 	ret := _m.Called(ctx, target)
 
-	var r0 image.Image
-	if rf, ok := ret.Get(0).(func(context.Context, string) image.Image); ok {
+	var r0 imagestore.Source
+	if rf, ok := ret.Get(0).(func(context.Context, string) imagestore.Source); ok {
 		r0 = rf(ctx, target)
 	} else {
-		if ret.Get(0) != nil {
-			r0 = ret.Get(0).(image.Image)
-		}
+		r0 = ret.Get(0).(imagestore.Source)
 	}
 
 	var r1 error
@@ -0,0 +1,378 @@
+package resizer
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/disintegration/imaging"
+	"github.com/pkg/errors"
+)
+
+// resizeOp is resize:WxH[,mode[,gravity]], a zero dimension keeps the aspect ratio.
+type resizeOp struct {
+	params Params
+}
+
+func newResizeOp(args []string) (Operation, error) {
+	if len(args) < 1 || len(args) > 3 {
+		return nil, errors.New("expected size, mode and gravity")
+	}
+
+	var (
+		op  resizeOp
+		err error
+	)
+	op.params.Width, op.params.Height, err = parseSize(args[0])
+	if err != nil {
+		return nil, err
+	}
+	if op.params.Mode, err = ParseMode(arg(args, 1)); err != nil {
+		return nil, err
+	}
+	if op.params.Gravity, err = ParseGravity(arg(args, 2)); err != nil {
+		return nil, err
+	}
+	if op.params.Gravity == GravityFocalPoint {
+		return nil, errors.New("focal point gravity is not supported")
+	}
+	if err := op.params.Validate(); err != nil {
+		return nil, err
+	}
+	return op, nil
+}
+
+func (op resizeOp) Apply(ctx context.Context, rt Runtime, img image.Image) (image.Image, error) {
+	return rt.ResizeImage(ctx, img, op.params)
+}
+
+func (op resizeOp) String() string {
+	return "resize:" + formatSize(op.params.Width, op.params.Height) + "," + string(op.params.Mode) + "," + string(op.params.Gravity)
+}
+
+// size returns the dimensions the operation resizes to.
+func (op resizeOp) size() (int, int) {
+	return op.params.Width, op.params.Height
+}
+
+// cropOp is crop:X,Y,W,H, the rectangle is clipped by the image bounds.
+type cropOp struct {
+	rect image.Rectangle
+}
+
+func newCropOp(args []string) (Operation, error) {
+	if len(args) != 4 {
+		return nil, errors.New("expected x, y, width and height")
+	}
+
+	var values [4]int
+	for i, a := range args {
+		v, err := strconv.Atoi(a)
+		if err != nil || v < 0 {
+			return nil, errors.Errorf("invalid value %q", a)
+		}
+		values[i] = v
+	}
+	if values[2] == 0 || values[3] == 0 {
+		return nil, errors.New("empty rectangle")
+	}
+	return cropOp{rect: image.Rect(values[0], values[1], values[0]+values[2], values[1]+values[3])}, nil
+}
+
+func (op cropOp) Apply(_ context.Context, _ Runtime, img image.Image) (image.Image, error) {
+	bounds := img.Bounds()
+	rect := op.rect.Add(bounds.Min).Intersect(bounds)
+	if rect.Empty() {
+		return nil, invalidParams("crop %v is outside of the image %v", op.rect, bounds.Size())
+	}
+	return imaging.Crop(img, rect), nil
+}
+
+func (op cropOp) String() string {
+	return "crop:" + strings.Join([]string{
+		strconv.Itoa(op.rect.Min.X),
+		strconv.Itoa(op.rect.Min.Y),
+		strconv.Itoa(op.rect.Dx()),
+		strconv.Itoa(op.rect.Dy()),
+	}, ",")
+}
+
+// rotateOp is rotate:degrees clockwise, uncovered corners become transparent.
+type rotateOp struct {
+	angle float64
+}
+
+func newRotateOp(args []string) (Operation, error) {
+	if len(args) != 1 {
+		return nil, errors.New("expected angle")
+	}
+	angle, err := parseFinite(args[0])
+	if err != nil {
+		return nil, errors.Errorf("invalid angle %q", args[0])
+	}
+	return rotateOp{angle: mod360(angle)}, nil
+}
+
+func (op rotateOp) Apply(_ context.Context, _ Runtime, img image.Image) (image.Image, error) {
+	// imaging rotates counter-clockwise
+	return imaging.Rotate(img, 360-op.angle, color.Transparent), nil
+}
+
+func (op rotateOp) String() string {
+	return "rotate:" + formatFloat(op.angle)
+}
+
+// flipOp is flip:h or flip:v.
+type flipOp struct {
+	direction string
+}
+
+func newFlipOp(args []string) (Operation, error) {
+	if len(args) != 1 || (args[0] != "h" && args[0] != "v") {
+		return nil, errors.New("expected h or v")
+	}
+	return flipOp{direction: args[0]}, nil
+}
+
+func (op flipOp) Apply(_ context.Context, _ Runtime, img image.Image) (image.Image, error) {
+	if op.direction == "h" {
+		return imaging.FlipH(img), nil
+	}
+	return imaging.FlipV(img), nil
+}
+
+func (op flipOp) String() string {
+	return "flip:" + op.direction
+}
+
+// sigmaOp is blur:sigma or sharpen:sigma.
+type sigmaOp struct {
+	name  string
+	sigma float64
+	apply func(image.Image, float64) *image.NRGBA
+}
+
+func newBlurOp(args []string) (Operation, error) {
+	return newSigmaOp("blur", imaging.Blur, args)
+}
+
+func newSharpenOp(args []string) (Operation, error) {
+	return newSigmaOp("sharpen", imaging.Sharpen, args)
+}
+
+func newSigmaOp(name string, apply func(image.Image, float64) *image.NRGBA, args []string) (Operation, error) {
+	if len(args) != 1 {
+		return nil, errors.New("expected sigma")
+	}
+	sigma, err := parseFinite(args[0])
+	if err != nil || sigma <= 0 || sigma > 100 {
+		return nil, errors.Errorf("sigma %q is out of range (0, 100]", args[0])
+	}
+	return sigmaOp{name: name, sigma: sigma, apply: apply}, nil
+}
+
+func (op sigmaOp) Apply(_ context.Context, _ Runtime, img image.Image) (image.Image, error) {
+	return op.apply(img, op.sigma), nil
+}
+
+func (op sigmaOp) String() string {
+	return op.name + ":" + formatFloat(op.sigma)
+}
+
+// adjustOp is adjust:name=value,... with brightness, contrast and saturation
+// in percents [-100, 100] and gamma above zero.
+type adjustOp struct {
+	values map[string]float64
+}
+
+func newAdjustOp(args []string) (Operation, error) {
+	if len(args) == 0 {
+		return nil, errors.New("expected adjustments")
+	}
+
+	op := adjustOp{values: make(map[string]float64, len(args))}
+	for _, a := range args {
+		parts := strings.SplitN(a, "=", 2)
+		if len(parts) != 2 {
+			return nil, errors.Errorf("invalid adjustment %q", a)
+		}
+		value, err := parseFinite(parts[1])
+		if err != nil {
+			return nil, errors.Errorf("invalid adjustment %q", a)
+		}
+
+		switch parts[0] {
+		case "brightness", "contrast", "saturation":
+			if value < -100 || value > 100 {
+				return nil, errors.Errorf("%s is out of range [-100, 100]", parts[0])
+			}
+		case "gamma":
+			if value <= 0 {
+				return nil, errors.New("gamma must be positive")
+			}
+		default:
+			return nil, errors.Errorf("unknown adjustment %q", parts[0])
+		}
+		op.values[parts[0]] = value
+	}
+	return op, nil
+}
+
+func (op adjustOp) Apply(_ context.Context, _ Runtime, img image.Image) (image.Image, error) {
+	if v, ok := op.values["brightness"]; ok {
+		img = imaging.AdjustBrightness(img, v)
+	}
+	if v, ok := op.values["contrast"]; ok {
+		img = imaging.AdjustContrast(img, v)
+	}
+	if v, ok := op.values["saturation"]; ok {
+		img = imaging.AdjustSaturation(img, v)
+	}
+	if v, ok := op.values["gamma"]; ok {
+		img = imaging.AdjustGamma(img, v)
+	}
+	return img, nil
+}
+
+func (op adjustOp) String() string {
+	names := make([]string, 0, len(op.values))
+	for name := range op.values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for i, name := range names {
+		names[i] = name + "=" + formatFloat(op.values[name])
+	}
+	return "adjust:" + strings.Join(names, ",")
+}
+
+type grayscaleOp struct{}
+
+func newGrayscaleOp(args []string) (Operation, error) {
+	if len(args) != 0 {
+		return nil, errors.New("expected no arguments")
+	}
+	return grayscaleOp{}, nil
+}
+
+func (grayscaleOp) Apply(_ context.Context, _ Runtime, img image.Image) (image.Image, error) {
+	return imaging.Grayscale(img), nil
+}
+
+func (grayscaleOp) String() string {
+	return "grayscale"
+}
+
+// overlayOp is overlay:target[,gravity[,opacity]], it draws another image, e.g. a watermark,
+// over the transformed one. The target is URL encoded and loaded like the source image.
+type overlayOp struct {
+	target  string
+	gravity Gravity
+	opacity float64
+}
+
+func newOverlayOp(args []string) (Operation, error) {
+	if len(args) < 1 || len(args) > 3 {
+		return nil, errors.New("expected target, gravity and opacity")
+	}
+
+	target, err := url.PathUnescape(args[0])
+	if err != nil || target == "" {
+		return nil, errors.Errorf("invalid target %q", args[0])
+	}
+	op := overlayOp{target: target, opacity: 1}
+
+	if op.gravity, err = ParseGravity(arg(args, 1)); err != nil {
+		return nil, err
+	}
+	if _, ok := anchors[op.gravity]; !ok {
+		return nil, errors.Errorf("unsupported gravity %q", op.gravity)
+	}
+	if s := arg(args, 2); s != "" {
+		op.opacity, err = parseFinite(s)
+		if err != nil || op.opacity < 0 || op.opacity > 1 {
+			return nil, errors.Errorf("opacity %q is out of range [0, 1]", s)
+		}
+	}
+	return op, nil
+}
+
+func (op overlayOp) Apply(ctx context.Context, rt Runtime, img image.Image) (image.Image, error) {
+	overlay, err := rt.LoadImage(ctx, op.target)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't load overlay")
+	}
+	return imaging.Overlay(img, overlay, anchorPoint(img.Bounds(), overlay.Bounds(), op.gravity), op.opacity), nil
+}
+
+func (op overlayOp) targets() []string {
+	return []string{op.target}
+}
+
+func (op overlayOp) String() string {
+	return "overlay:" + url.PathEscape(op.target) + "," + string(op.gravity) + "," + formatFloat(op.opacity)
+}
+
+// anchorPoint returns the position of the overlay inside the background according to gravity.
+func anchorPoint(background, overlay image.Rectangle, gravity Gravity) image.Point {
+	anchor := anchors[gravity]
+	x := int(anchor.X * float64(background.Dx()-overlay.Dx()))
+	y := int(anchor.Y * float64(background.Dy()-overlay.Dy()))
+	return background.Min.Add(image.Pt(x, y))
+}
+
+// parseSize parses WxH where either dimension may be omitted.
+func parseSize(s string) (int, int, error) {
+	parts := strings.Split(s, "x")
+	if len(parts) != 2 {
+		return 0, 0, errors.Errorf("invalid size %q", s)
+	}
+
+	var size [2]int
+	for i, part := range parts {
+		if part == "" {
+			continue
+		}
+		v, err := strconv.Atoi(part)
+		if err != nil {
+			return 0, 0, errors.Errorf("invalid size %q", s)
+		}
+		size[i] = v
+	}
+	return size[0], size[1], nil
+}
+
+// parseFinite parses a float rejecting NaN and infinities.
+func parseFinite(s string) (float64, error) {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, errors.Errorf("invalid number %q", s)
+	}
+	return f, nil
+}
+
+func formatSize(width, height int) string {
+	return strconv.Itoa(width) + "x" + strconv.Itoa(height)
+}
+
+func mod360(angle float64) float64 {
+	angle = math.Mod(angle, 360)
+	if angle < 0 {
+		angle += 360
+	}
+	return angle
+}
+
+// arg returns the argument at i or an empty string when it is missing.
+func arg(args []string, i int) string {
+	if i < len(args) {
+		return args[i]
+	}
+	return ""
+}
@@ -1,6 +1,12 @@
 package resizer
 
-import "go.uber.org/zap"
+import (
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/ivanovaleksey/resizer/internal/pkg/imagestore"
+)
 
 type ServiceOption func(*Service)
 
@@ -10,12 +16,48 @@ func WithImageProvider(provider ImageProvider) ServiceOption {
 	}
 }
 
+// WithImageDecoder sets the decoder of source images, the default one has no limits.
+func WithImageDecoder(decoder ImageDecoder) ServiceOption {
+	return func(service *Service) {
+		service.imageDecoder = decoder
+	}
+}
+
 func WithImageResizer(resizer ImageResizer) ServiceOption {
 	return func(service *Service) {
 		service.imageResizer = resizer
 	}
 }
 
+// WithSmartResizer sets the resizer used for requests with GravitySmart.
+func WithSmartResizer(resizer ImageResizer) ServiceOption {
+	return func(service *Service) {
+		service.smartResizer = resizer
+	}
+}
+
+// WithResultCache sets the cache for encoded results.
+func WithResultCache(provider CacheProvider) ServiceOption {
+	return func(service *Service) {
+		service.resultCache = provider
+	}
+}
+
+// WithOutputLimits bounds the dimensions of results, requests exceeding them are invalid.
+func WithOutputLimits(limits imagestore.Limits) ServiceOption {
+	return func(service *Service) {
+		service.outputLimits = limits
+	}
+}
+
+// WithWorkers bounds the number of images processed at once and the queue waiting for a worker,
+// zero values keep the defaults and a negative queue size disables the queue.
+func WithWorkers(workers, queueSize int, queueWait time.Duration) ServiceOption {
+	return func(service *Service) {
+		service.workers = newWorkerPool(workers, queueSize, queueWait)
+	}
+}
+
 func WithLogger(logger *zap.Logger) ServiceOption {
 	return func(service *Service) {
 		service.logger = logger
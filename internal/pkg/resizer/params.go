@@ -1,6 +1,78 @@
 package resizer
 
+import (
+	"github.com/pkg/errors"
+
+	"github.com/ivanovaleksey/resizer/internal/pkg/encoder"
+	"github.com/ivanovaleksey/resizer/internal/pkg/format"
+)
+
+// Mode defines how the source image is fitted into the requested box.
+type Mode string
+
+const (
+	// ModeStretch scales the image to the exact size ignoring the aspect ratio.
+	ModeStretch Mode = "stretch"
+	// ModeFit scales the image down to fit inside the box keeping the aspect ratio.
+	ModeFit Mode = "fit"
+	// ModeFill scales the image to cover the box and crops the overflow.
+	ModeFill Mode = "fill"
+	// ModePad fits the image inside the box and pads the rest with transparent color.
+	ModePad Mode = "pad"
+)
+
+func ParseMode(s string) (Mode, error) {
+	switch mode := Mode(s); mode {
+	case "":
+		return ModeStretch, nil
+	case ModeStretch, ModeFit, ModeFill, ModePad:
+		return mode, nil
+	default:
+		return "", errors.Errorf("unknown mode %q", s)
+	}
+}
+
+// Params describes the requested transformation.
+// Zero width or height means it is calculated from the aspect ratio of the source image.
 type Params struct {
-	Width  int
-	Height int
+	Width      int
+	Height     int
+	Mode       Mode
+	Gravity    Gravity
+	FocalPoint FocalPoint      // used with GravityFocalPoint only
+	Format     format.Format   // empty means it is negotiated with the client
+	Accept     []format.Format // formats accepted by the client, used with empty Format
+	Encoding   encoder.Options
+	Ops        Pipeline // applied after the resize
+
+	// KeepMetadata preserves the ICC profile and copyright of the source,
+	// any other metadata is always stripped.
+	KeepMetadata bool
+}
+
+func (p Params) Validate() error {
+	if p.Width < 0 {
+		return invalidParams("negative width")
+	}
+	if p.Height < 0 {
+		return invalidParams("negative height")
+	}
+	if p.Width == 0 && p.Height == 0 && len(p.Ops) == 0 {
+		return invalidParams("either width, height or operations are required")
+	}
+	if _, err := ParseMode(string(p.Mode)); err != nil {
+		return invalidParams(err.Error())
+	}
+	if _, err := ParseGravity(string(p.Gravity)); err != nil {
+		return invalidParams(err.Error())
+	}
+	if p.Gravity == GravityFocalPoint {
+		if err := p.FocalPoint.Validate(); err != nil {
+			return invalidParams(err.Error())
+		}
+	}
+	if p.Format != "" && !encoder.Supported(p.Format) {
+		return invalidParams("unsupported format %q", p.Format)
+	}
+	return nil
 }
@@ -0,0 +1,127 @@
+package resizer
+
+import (
+	"context"
+	"image"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/ivanovaleksey/resizer/internal/pkg/imagestore"
+)
+
+// MaxOperations bounds the length of a pipeline.
+const MaxOperations = 16
+
+// Operation is a single step of a pipeline.
+type Operation interface {
+	Apply(ctx context.Context, rt Runtime, img image.Image) (image.Image, error)
+	// String returns the canonical form of the operation used in cache keys.
+	String() string
+}
+
+// Runtime provides operations with the services of the Service running them.
+type Runtime interface {
+	// LoadImage loads images operations need besides the transformed one, e.g. overlays.
+	LoadImage(ctx context.Context, target string) (image.Image, error)
+	// ResizeImage resizes with the configured resizers.
+	ResizeImage(ctx context.Context, img image.Image, params Params) (image.Image, error)
+}
+
+// sizer is implemented by operations resizing to the known dimensions,
+// so they are checked against the output limits before processing.
+type sizer interface {
+	size() (int, int)
+}
+
+// loader is implemented by operations loading other images, so their versions
+// are a part of the version of the result.
+type loader interface {
+	targets() []string
+}
+
+// OperationFactory creates an operation from its comma separated arguments.
+type OperationFactory func(args []string) (Operation, error)
+
+var operations = map[string]OperationFactory{
+	"resize":    newResizeOp,
+	"crop":      newCropOp,
+	"rotate":    newRotateOp,
+	"flip":      newFlipOp,
+	"blur":      newBlurOp,
+	"sharpen":   newSharpenOp,
+	"adjust":    newAdjustOp,
+	"grayscale": newGrayscaleOp,
+	"overlay":   newOverlayOp,
+}
+
+// RegisterOperation adds or replaces the operation with the name.
+// It is not safe to call concurrently with ParsePipeline, so call it on start up.
+func RegisterOperation(name string, factory OperationFactory) {
+	operations[name] = factory
+}
+
+// Pipeline is an ordered list of operations applied after the resize described by Params.
+type Pipeline []Operation
+
+// ParsePipeline parses operations like "resize:300x200|sharpen:0.5|grayscale".
+func ParsePipeline(s string) (Pipeline, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	specs := strings.Split(s, "|")
+	if len(specs) > MaxOperations {
+		return nil, invalidParams("too many operations, the maximum is %d", MaxOperations)
+	}
+
+	var pipeline Pipeline
+	for _, spec := range specs {
+		name, args := spec, []string(nil)
+		if i := strings.IndexByte(spec, ':'); i >= 0 {
+			name, args = spec[:i], strings.Split(spec[i+1:], ",")
+		}
+
+		factory, ok := operations[name]
+		if !ok {
+			return nil, invalidParams("unknown operation %q", name)
+		}
+		op, err := factory(args)
+		if err != nil {
+			return nil, invalidParams("invalid operation %q: %v", spec, err)
+		}
+		pipeline = append(pipeline, op)
+	}
+	return pipeline, nil
+}
+
+// Apply runs the operations in order, it stops as soon as the context is done.
+// The image is checked against the limits after every operation,
+// so operations growing it, like rotations, can't be chained to exhaust memory.
+func (p Pipeline) Apply(ctx context.Context, rt Runtime, img image.Image, limits imagestore.Limits) (image.Image, error) {
+	for _, op := range p {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		var err error
+		img, err = op.Apply(ctx, rt, img)
+		if err != nil {
+			return nil, errors.Wrapf(err, "can't apply %s", op)
+		}
+
+		bounds := img.Bounds()
+		if err := limits.Check(bounds.Dx(), bounds.Dy()); err != nil {
+			return nil, invalidParams("%s: %v", op, err)
+		}
+	}
+	return img, nil
+}
+
+func (p Pipeline) String() string {
+	specs := make([]string, len(p))
+	for i, op := range p {
+		specs[i] = op.String()
+	}
+	return strings.Join(specs, "|")
+}
@@ -0,0 +1,184 @@
+package resizer
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+
+	"github.com/disintegration/imaging"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ivanovaleksey/resizer/internal/pkg/imagestore"
+)
+
+func TestParsePipeline(t *testing.T) {
+	t.Run("it parses operations in order", func(t *testing.T) {
+		pipeline, err := ParsePipeline("resize:300x|crop:10,20,100,50|rotate:-90|flip:h|blur:1.5|sharpen:0.5|adjust:gamma=1.2,brightness=10|grayscale|overlay:logo%2C1.png,southeast,0.5")
+		require.NoError(t, err)
+
+		expected := "resize:300x0,stretch,center|crop:10,20,100,50|rotate:270|flip:h|blur:1.5|sharpen:0.5|" +
+			"adjust:brightness=10,gamma=1.2|grayscale|overlay:logo%2C1.png,southeast,0.5"
+		assert.Equal(t, expected, pipeline.String())
+
+		again, err := ParsePipeline(pipeline.String())
+		require.NoError(t, err)
+		assert.Equal(t, expected, again.String())
+	})
+
+	t.Run("it rejects invalid operations", func(t *testing.T) {
+		for _, s := range []string{
+			"unknown",
+			"resize",
+			"resize:x",
+			"resize:300x200,fill,fp",
+			"crop:10,20,100",
+			"crop:10,20,0,50",
+			"rotate:NaN",
+			"flip:d",
+			"blur:0",
+			"sharpen:abc",
+			"adjust:contrast=200",
+			"adjust:hue=10",
+			"grayscale:1",
+			"overlay:logo.png,fp",
+			"overlay:logo.png,center,2",
+			"grayscale|",
+			strings.Repeat("grayscale|", MaxOperations) + "grayscale",
+		} {
+			_, err := ParsePipeline(s)
+			assert.Equal(t, ErrInvalidParams, errors.Cause(err), s)
+		}
+	})
+}
+
+func TestPipeline_Apply(t *testing.T) {
+	ctx := context.Background()
+	srcImage := imaging.New(200, 100, color.NRGBA{R: 255, A: 255})
+
+	cases := []struct {
+		ops            string
+		expectedWidth  int
+		expectedHeight int
+	}{
+		{"resize:100x,fit", 100, 50},
+		{"crop:150,50,100,100", 50, 50},
+		{"rotate:90", 100, 200},
+		{"resize:50x50,fill|rotate:180|flip:v|blur:1|sharpen:1|adjust:contrast=10|grayscale", 50, 50},
+		{"overlay:logo.png,northwest,0.5", 200, 100},
+	}
+
+	rt := testRuntime{load: func(ctx context.Context, target string) (image.Image, error) {
+		return imaging.New(20, 20, color.NRGBA{B: 255, A: 255}), nil
+	}}
+	noLimits := imagestore.Limits{}
+	for _, tc := range cases {
+		pipeline, err := ParsePipeline(tc.ops)
+		require.NoError(t, err, tc.ops)
+
+		out, err := pipeline.Apply(ctx, rt, srcImage, noLimits)
+		require.NoError(t, err, tc.ops)
+		assert.Equal(t, tc.expectedWidth, out.Bounds().Dx(), tc.ops)
+		assert.Equal(t, tc.expectedHeight, out.Bounds().Dy(), tc.ops)
+	}
+
+	t.Run("it draws overlays by gravity", func(t *testing.T) {
+		pipeline, err := ParsePipeline("overlay:logo.png,southeast")
+		require.NoError(t, err)
+
+		out, err := pipeline.Apply(ctx, rt, srcImage, noLimits)
+		require.NoError(t, err)
+		assert.Equal(t, color.NRGBA{B: 255, A: 255}, imaging.Clone(out).NRGBAAt(190, 90))
+		assert.Equal(t, color.NRGBA{R: 255, A: 255}, imaging.Clone(out).NRGBAAt(170, 70))
+	})
+
+	t.Run("it checks the size after every operation", func(t *testing.T) {
+		limits := imagestore.Limits{MaxWidth: 400, MaxHeight: 400}
+
+		// every rotation by 45 degrees grows the image
+		pipeline, err := ParsePipeline("rotate:45|rotate:45|rotate:45|rotate:45|rotate:45|rotate:45")
+		require.NoError(t, err)
+		_, err = pipeline.Apply(ctx, rt, srcImage, limits)
+		assert.Equal(t, ErrInvalidParams, errors.Cause(err))
+
+		// the derived height exceeds the limit
+		pipeline, err = ParsePipeline("rotate:90|resize:300x")
+		require.NoError(t, err)
+		_, err = pipeline.Apply(ctx, rt, srcImage, limits)
+		assert.Equal(t, ErrInvalidParams, errors.Cause(err))
+
+		pipeline, err = ParsePipeline("rotate:90|resize:150x")
+		require.NoError(t, err)
+		_, err = pipeline.Apply(ctx, rt, srcImage, limits)
+		assert.NoError(t, err)
+	})
+
+	t.Run("it resizes with the runtime resizer", func(t *testing.T) {
+		pipeline, err := ParsePipeline("resize:50x50")
+		require.NoError(t, err)
+
+		rt := rt
+		rt.resizer = fixedResizer{size: 7}
+		out, err := pipeline.Apply(ctx, rt, srcImage, noLimits)
+		require.NoError(t, err)
+		assert.Equal(t, image.Rect(0, 0, 7, 7), out.Bounds())
+	})
+
+	t.Run("it stops when context is done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+
+		calls := 0
+		RegisterOperation("cancel", func([]string) (Operation, error) {
+			return cancelOp{cancel: func() { calls++; cancel() }}, nil
+		})
+		defer delete(operations, "cancel")
+
+		pipeline, err := ParsePipeline("cancel|cancel")
+		require.NoError(t, err)
+
+		_, err = pipeline.Apply(ctx, rt, srcImage, noLimits)
+		assert.Equal(t, context.Canceled, err)
+		assert.Equal(t, 1, calls)
+	})
+}
+
+type testRuntime struct {
+	load    func(ctx context.Context, target string) (image.Image, error)
+	resizer ImageResizer
+}
+
+func (rt testRuntime) LoadImage(ctx context.Context, target string) (image.Image, error) {
+	return rt.load(ctx, target)
+}
+
+func (rt testRuntime) ResizeImage(ctx context.Context, img image.Image, params Params) (image.Image, error) {
+	if rt.resizer != nil {
+		return rt.resizer.Resize(ctx, img, params)
+	}
+	return NewSmartResizer().Resize(ctx, img, params)
+}
+
+type cancelOp struct {
+	cancel func()
+}
+
+func (op cancelOp) Apply(_ context.Context, _ Runtime, img image.Image) (image.Image, error) {
+	op.cancel()
+	return img, nil
+}
+
+func (cancelOp) String() string {
+	return "cancel"
+}
+
+// fixedResizer ignores params and returns a square of the size.
+type fixedResizer struct {
+	size int
+}
+
+func (r fixedResizer) Resize(context.Context, image.Image, Params) (image.Image, error) {
+	return imaging.New(r.size, r.size, color.Transparent), nil
+}
@@ -0,0 +1,80 @@
+package resizer
+
+import (
+	"context"
+	"runtime"
+	"time"
+)
+
+const (
+	// DefaultQueueWait is the default maximal time work waits for a free worker.
+	DefaultQueueWait = time.Second
+
+	// defaultQueueFactor is the default number of waiting requests per worker.
+	defaultQueueFactor = 4
+)
+
+// workerPool bounds the number of images processed at once.
+// Work waits for a free worker in a bounded queue and is rejected with ErrOverloaded
+// when the queue is full or the wait is too long, so spikes are shed instead of slowing everything.
+type workerPool struct {
+	workers chan struct{}
+	queue   chan struct{}
+	wait    time.Duration
+}
+
+// newWorkerPool creates the pool, zero values are replaced with the defaults:
+// GOMAXPROCS workers, four waiting requests per worker and DefaultQueueWait.
+// A negative queue size disables the queue.
+func newWorkerPool(workers, queueSize int, wait time.Duration) *workerPool {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if queueSize == 0 {
+		queueSize = defaultQueueFactor * workers
+	}
+	if queueSize < 0 {
+		queueSize = 0
+	}
+	if wait <= 0 {
+		wait = DefaultQueueWait
+	}
+
+	return &workerPool{
+		workers: make(chan struct{}, workers),
+		queue:   make(chan struct{}, queueSize),
+		wait:    wait,
+	}
+}
+
+// acquire takes a worker, the returned function must be called to release it.
+func (p *workerPool) acquire(ctx context.Context) (func(), error) {
+	select {
+	case p.workers <- struct{}{}:
+		return p.release, nil
+	default:
+	}
+
+	select {
+	case p.queue <- struct{}{}:
+		defer func() { <-p.queue }()
+	default:
+		return nil, ErrOverloaded
+	}
+
+	timer := time.NewTimer(p.wait)
+	defer timer.Stop()
+
+	select {
+	case p.workers <- struct{}{}:
+		return p.release, nil
+	case <-timer.C:
+		return nil, ErrOverloaded
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (p *workerPool) release() {
+	<-p.workers
+}
@@ -0,0 +1,88 @@
+package resizer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkerPool(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("it queues work until a worker is free", func(t *testing.T) {
+		pool := newWorkerPool(1, 1, time.Second)
+
+		release, err := pool.acquire(ctx)
+		require.NoError(t, err)
+
+		acquired := make(chan error, 1)
+		go func() {
+			release, err := pool.acquire(ctx)
+			if err == nil {
+				release()
+			}
+			acquired <- err
+		}()
+
+		time.Sleep(50 * time.Millisecond)
+		release()
+		assert.NoError(t, <-acquired)
+	})
+
+	t.Run("it sheds work when the queue is full", func(t *testing.T) {
+		pool := newWorkerPool(1, 1, 200*time.Millisecond)
+
+		release, err := pool.acquire(ctx)
+		require.NoError(t, err)
+		defer release()
+
+		queued := make(chan error, 1)
+		go func() {
+			_, err := pool.acquire(ctx)
+			queued <- err
+		}()
+		time.Sleep(50 * time.Millisecond)
+
+		_, err = pool.acquire(ctx)
+		assert.Equal(t, ErrOverloaded, err)
+		assert.Equal(t, ErrOverloaded, <-queued)
+	})
+
+	t.Run("it sheds work waiting too long", func(t *testing.T) {
+		pool := newWorkerPool(1, 1, 50*time.Millisecond)
+
+		release, err := pool.acquire(ctx)
+		require.NoError(t, err)
+		defer release()
+
+		_, err = pool.acquire(ctx)
+		assert.Equal(t, ErrOverloaded, err)
+	})
+
+	t.Run("it stops waiting when context is done", func(t *testing.T) {
+		pool := newWorkerPool(1, 1, time.Second)
+
+		release, err := pool.acquire(ctx)
+		require.NoError(t, err)
+		defer release()
+
+		ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		_, err = pool.acquire(ctx)
+		assert.Equal(t, context.DeadlineExceeded, err)
+	})
+
+	t.Run("it rejects at once without a queue", func(t *testing.T) {
+		pool := newWorkerPool(1, -1, time.Second)
+
+		release, err := pool.acquire(ctx)
+		require.NoError(t, err)
+		defer release()
+
+		_, err = pool.acquire(ctx)
+		assert.Equal(t, ErrOverloaded, err)
+	})
+}
@@ -0,0 +1,162 @@
+package resizer
+
+import (
+	"context"
+	"image"
+	"math"
+
+	"github.com/disintegration/imaging"
+)
+
+const (
+	// lanczosSupport is the radius of the Lanczos3 filter
+	lanczosSupport = 3.0
+
+	// cancelCheckRows is the number of rows processed between context checks,
+	// it keeps the overhead negligible while aborting within milliseconds.
+	cancelCheckRows = 16
+)
+
+// resample resizes the image with the Lanczos3 filter like imaging.Resize does,
+// but it checks the context between batches of rows, so abandoned work stops early.
+// A zero dimension is calculated from the aspect ratio.
+func resample(ctx context.Context, img image.Image, width, height int) (*image.NRGBA, error) {
+	srcW, srcH := img.Bounds().Dx(), img.Bounds().Dy()
+	if width == 0 && height == 0 || srcW <= 0 || srcH <= 0 {
+		return &image.NRGBA{}, nil
+	}
+	if width == 0 {
+		width = maxInt(1, int(float64(srcW)*float64(height)/float64(srcH)+0.5))
+	}
+	if height == 0 {
+		height = maxInt(1, int(float64(srcH)*float64(width)/float64(srcW)+0.5))
+	}
+
+	src := imaging.Clone(img)
+	if width == srcW && height == srcH {
+		return src, nil
+	}
+
+	tmp := src
+	if width != srcW {
+		tmp = image.NewNRGBA(image.Rect(0, 0, width, srcH))
+		ws := weights(width, srcW)
+		for y := 0; y < srcH; y++ {
+			if y%cancelCheckRows == 0 {
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
+			}
+			for x := 0; x < width; x++ {
+				convolve(src.Pix, ws[x], y*src.Stride, 4, tmp.Pix[y*tmp.Stride+x*4:])
+			}
+		}
+	}
+
+	if height == srcH {
+		return tmp, nil
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	ws := weights(height, srcH)
+	for y := 0; y < height; y++ {
+		if y%cancelCheckRows == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		for x := 0; x < width; x++ {
+			convolve(tmp.Pix, ws[y], x*4, tmp.Stride, dst.Pix[y*dst.Stride+x*4:])
+		}
+	}
+	return dst, nil
+}
+
+type weight struct {
+	index int
+	value float64
+}
+
+// weights returns the normalized filter weights of source pixels for every destination pixel.
+func weights(dstSize, srcSize int) [][]weight {
+	scale := float64(srcSize) / float64(dstSize)
+	stretch := math.Max(scale, 1) // widen the filter when downscaling to avoid aliasing
+	support := lanczosSupport * stretch
+
+	result := make([][]weight, dstSize)
+	for v := range result {
+		center := (float64(v) + 0.5) * scale
+		begin := maxInt(0, int(math.Floor(center-support)))
+		end := minInt(srcSize, int(math.Ceil(center+support)))
+
+		var sum float64
+		ws := make([]weight, 0, end-begin)
+		for u := begin; u < end; u++ {
+			w := lanczos((float64(u) + 0.5 - center) / stretch)
+			if w != 0 {
+				ws = append(ws, weight{index: u, value: w})
+				sum += w
+			}
+		}
+		for i := range ws {
+			ws[i].value /= sum
+		}
+		result[v] = ws
+	}
+	return result
+}
+
+func lanczos(x float64) float64 {
+	x = math.Abs(x)
+	if x >= lanczosSupport {
+		return 0
+	}
+	return sinc(x) * sinc(x/lanczosSupport)
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
+
+// convolve writes the weighted sum of NRGBA pixels at offset+index*step into out,
+// colors are weighted by alpha, so transparent pixels don't bleed into opaque ones.
+func convolve(pix []uint8, ws []weight, offset, step int, out []uint8) {
+	var r, g, b, a float64
+	for _, w := range ws {
+		i := offset + w.index*step
+		alpha := float64(pix[i+3]) * w.value
+		r += float64(pix[i]) * alpha
+		g += float64(pix[i+1]) * alpha
+		b += float64(pix[i+2]) * alpha
+		a += alpha
+	}
+
+	if a <= 0 {
+		out[0], out[1], out[2], out[3] = 0, 0, 0, 0
+		return
+	}
+	out[0] = clampUint8(r / a)
+	out[1] = clampUint8(g / a)
+	out[2] = clampUint8(b / a)
+	out[3] = clampUint8(a)
+}
+
+func clampUint8(x float64) uint8 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 255 {
+		return 255
+	}
+	return uint8(x + 0.5)
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,66 @@
+package resizer
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/disintegration/imaging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResample(t *testing.T) {
+	// vertical stripes with a transparent column
+	srcImage := imaging.New(300, 200, color.NRGBA{R: 255, A: 255})
+	srcImage = imaging.Paste(srcImage, imaging.New(100, 200, color.NRGBA{B: 255, A: 255}), image.Pt(100, 0))
+	srcImage = imaging.Paste(srcImage, imaging.New(100, 200, color.NRGBA{}), image.Pt(200, 0))
+
+	t.Run("it matches imaging", func(t *testing.T) {
+		for _, size := range []image.Point{{150, 100}, {600, 50}, {30, 400}} {
+			out, err := resample(context.Background(), srcImage, size.X, size.Y)
+			require.NoError(t, err)
+
+			expected := imaging.Resize(srcImage, size.X, size.Y, imaging.Lanczos)
+			require.Equal(t, expected.Bounds(), out.Bounds(), size)
+			for i := range out.Pix {
+				assert.InDelta(t, expected.Pix[i], out.Pix[i], 2, "%v at %d", size, i)
+			}
+		}
+	})
+
+	t.Run("it keeps the aspect ratio", func(t *testing.T) {
+		out, err := resample(context.Background(), srcImage, 0, 100)
+		require.NoError(t, err)
+		assert.Equal(t, image.Rect(0, 0, 150, 100), out.Bounds())
+	})
+
+	t.Run("it stops when context is done", func(t *testing.T) {
+		for _, size := range []image.Point{{150, 200}, {300, 100}} {
+			ctx := &countingContext{Context: context.Background(), limit: 1}
+
+			out, err := resample(ctx, srcImage, size.X, size.Y)
+			assert.Equal(t, context.Canceled, err, size)
+			assert.Nil(t, out, size)
+			// the first batch is processed, the next check aborts
+			assert.Equal(t, 2, ctx.checks, size)
+		}
+	})
+}
+
+// countingContext is canceled after the limit of checks,
+// it counts checks to show how much work is done after cancellation.
+type countingContext struct {
+	context.Context
+	limit  int
+	checks int
+}
+
+func (c *countingContext) Err() error {
+	c.checks++
+	if c.checks > c.limit {
+		return context.Canceled
+	}
+	return nil
+}
@@ -1,7 +1,9 @@
 package resizer
 
 import (
+	"context"
 	"image"
+	"image/color"
 
 	"github.com/disintegration/imaging"
 )
@@ -13,6 +15,44 @@ func NewResizer() Resizer {
 	return Resizer{}
 }
 
-func (r Resizer) Resize(img image.Image, params Params) (image.Image, error) {
-	return imaging.Resize(img, params.Width, params.Height, imaging.Lanczos), nil
+// Resize stops as soon as the context is done and returns its error.
+func (r Resizer) Resize(ctx context.Context, img image.Image, params Params) (image.Image, error) {
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+
+	width, height := params.Width, params.Height
+	if width == 0 || height == 0 {
+		return resample(ctx, img, width, height)
+	}
+
+	switch params.Mode {
+	case ModeFit:
+		return fit(ctx, img, width, height)
+	case ModeFill:
+		return fill(ctx, img, params)
+	case ModePad:
+		fitted, err := fit(ctx, img, width, height)
+		if err != nil {
+			return nil, err
+		}
+		return imaging.PasteCenter(imaging.New(width, height, color.Transparent), fitted), nil
+	default:
+		return resample(ctx, img, width, height)
+	}
+}
+
+// fit scales the image down to fit inside the box keeping the aspect ratio like imaging.Fit.
+func fit(ctx context.Context, img image.Image, width, height int) (*image.NRGBA, error) {
+	srcW, srcH := img.Bounds().Dx(), img.Bounds().Dy()
+	if srcW <= width && srcH <= height {
+		return imaging.Clone(img), nil
+	}
+
+	if float64(srcW)*float64(height) > float64(srcH)*float64(width) {
+		height = 0
+	} else {
+		width = 0
+	}
+	return resample(ctx, img, width, height)
 }
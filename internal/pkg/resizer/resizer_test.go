@@ -0,0 +1,88 @@
+package resizer
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/disintegration/imaging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ivanovaleksey/resizer/test"
+)
+
+func TestResizer_Modes(t *testing.T) {
+	// source image is 2560x1920
+	srcImage := test.SampleImage(t, 3)
+
+	cases := []struct {
+		name           string
+		params         Params
+		expectedWidth  int
+		expectedHeight int
+	}{
+		{"stretch", Params{Width: 500, Height: 300, Mode: ModeStretch}, 500, 300},
+		{"fit", Params{Width: 500, Height: 300, Mode: ModeFit}, 400, 300},
+		{"fill", Params{Width: 500, Height: 300, Mode: ModeFill}, 500, 300},
+		{"pad", Params{Width: 500, Height: 300, Mode: ModePad}, 500, 300},
+		{"zero height", Params{Width: 400, Mode: ModeFill}, 400, 300},
+		{"zero width", Params{Height: 300, Mode: ModeStretch}, 400, 300},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := NewResizer().Resize(context.Background(), srcImage, tc.params)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedWidth, out.Bounds().Dx())
+			assert.Equal(t, tc.expectedHeight, out.Bounds().Dy())
+		})
+	}
+
+	t.Run("with invalid params", func(t *testing.T) {
+		_, err := NewResizer().Resize(context.Background(), srcImage, Params{})
+		assert.Error(t, err)
+	})
+}
+
+func TestResizer_Gravity(t *testing.T) {
+	// left half is red, right half is blue
+	srcImage := imaging.New(200, 100, color.NRGBA{R: 255, A: 255})
+	srcImage = imaging.Paste(srcImage, imaging.New(100, 100, color.NRGBA{B: 255, A: 255}), image.Pt(100, 0))
+
+	red := color.NRGBA{R: 255, A: 255}
+	blue := color.NRGBA{B: 255, A: 255}
+
+	cases := []struct {
+		name     string
+		params   Params
+		expected color.NRGBA
+	}{
+		{"west", Params{Gravity: GravityWest}, red},
+		{"east", Params{Gravity: GravityEast}, blue},
+		{"focal point on the left", Params{Gravity: GravityFocalPoint, FocalPoint: FocalPoint{X: 0.1, Y: 0.5}}, red},
+		{"focal point on the right", Params{Gravity: GravityFocalPoint, FocalPoint: FocalPoint{X: 0.9, Y: 0.5}}, blue},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			params := tc.params
+			params.Width, params.Height, params.Mode = 50, 50, ModeFill
+
+			out, err := NewResizer().Resize(context.Background(), srcImage, params)
+			require.NoError(t, err)
+			require.Equal(t, image.Rect(0, 0, 50, 50), out.Bounds())
+			assert.Equal(t, tc.expected, color.NRGBAModel.Convert(out.At(25, 25)))
+		})
+	}
+
+	t.Run("with focal point out of range", func(t *testing.T) {
+		for _, fp := range []FocalPoint{{X: 2}, {X: math.NaN()}, {Y: math.NaN()}, {X: math.Inf(1)}, {Y: math.Inf(-1)}} {
+			params := Params{Width: 50, Height: 50, Mode: ModeFill, Gravity: GravityFocalPoint, FocalPoint: fp}
+			_, err := NewResizer().Resize(context.Background(), srcImage, params)
+			assert.Error(t, err, "%v", fp)
+		}
+	})
+}
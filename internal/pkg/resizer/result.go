@@ -0,0 +1,8 @@
+package resizer
+
+// Result is an encoded image ready to be sent to the client.
+type Result struct {
+	ContentType string
+	ETag        string
+	Data        []byte
+}
@@ -1,67 +1,306 @@
 package resizer
 
 import (
+	"bytes"
 	"context"
+	"fmt"
 	"image"
 
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
+
+	"github.com/ivanovaleksey/resizer/internal/pkg/cache"
+	"github.com/ivanovaleksey/resizer/internal/pkg/encoder"
+	"github.com/ivanovaleksey/resizer/internal/pkg/format"
+	"github.com/ivanovaleksey/resizer/internal/pkg/imagestore"
+	"github.com/ivanovaleksey/resizer/internal/pkg/metadata"
+	"github.com/ivanovaleksey/resizer/internal/pkg/singleflight"
 )
 
 type Service struct {
 	logger        *zap.Logger
 	imageProvider ImageProvider
+	imageDecoder  ImageDecoder
 	imageResizer  ImageResizer
+	smartResizer  ImageResizer
+	resultCache   CacheProvider
+	outputLimits  imagestore.Limits
+	workers       *workerPool
+	flights       *singleflight.Group
 }
 
 type ImageProvider interface {
-	GetImage(ctx context.Context, target string) (image.Image, error)
+	GetImage(ctx context.Context, target string) (imagestore.Source, error)
+}
+
+type ImageDecoder interface {
+	Decode(imagestore.Source) (image.Image, format.Format, error)
 }
 
+// ImageResizer must stop and return the context error as soon as the context is done.
 type ImageResizer interface {
-	Resize(image.Image, Params) (image.Image, error)
+	Resize(context.Context, image.Image, Params) (image.Image, error)
+}
+
+type CacheProvider interface {
+	Get(cache.Entity) (cache.Item, error)
+	Set(cache.Entity, cache.Item) error
 }
 
 func NewService(opts ...ServiceOption) (Service, error) {
 	s := Service{
 		logger:        zap.NewNop(),
 		imageProvider: dummyImageProvider{},
+		imageDecoder:  imagestore.Decoder{},
 		imageResizer:  dummyResizer{},
+		smartResizer:  dummyResizer{},
+		resultCache:   dummyCacheProvider{},
+		workers:       newWorkerPool(0, 0, 0),
 	}
 
 	for _, opt := range opts {
 		opt(&s)
 	}
 
+	s.flights = singleflight.NewGroup("resizer",
+		singleflight.WithGroupLogger(s.logger),
+		singleflight.WithCommit(s.store),
+	)
+
 	return s, nil
 }
 
-func (r Service) Resize(ctx context.Context, target string, params Params) (image.Image, error) {
-	img, err := r.imageProvider.GetImage(ctx, target)
+// Resize returns the encoded target transformed according to params.
+// Results are cached by the version of the source and concurrent identical calls share the work.
+func (r Service) Resize(ctx context.Context, target string, params Params) (Result, error) {
+	if err := r.checkOutputParams(params); err != nil {
+		return Result{}, err
+	}
+
+	srcs, err := r.sources(ctx, target, params)
+	if err != nil {
+		return Result{}, err
+	}
+
+	e := cache.Entity(resultKey(target, srcs.version(), params))
+
+	cached, err := r.resultCache.Get(e)
+	if err == nil {
+		r.logger.Debug("result cache hit")
+		return Result{ContentType: cached.ContentType, ETag: cached.ETag, Data: cached.Data}, nil
+	}
+	if err != cache.ErrCacheMiss {
+		r.logger.Error("can't get result cache", zap.Error(err), zap.String("key", e.Key()))
+	}
+
+	result, err := r.flights.Do(ctx, e.Key(), func(ctx context.Context) (interface{}, error) {
+		return r.resize(ctx, srcs, params)
+	})
+	if err != nil {
+		return Result{}, err
+	}
+	res, ok := result.(Result)
+	if !ok {
+		return Result{}, errors.Errorf("unexpected %T resized for %s", result, target)
+	}
+	return res, nil
+}
+
+// store caches the result, the group calls it only for results which are not forgotten.
+func (r Service) store(key string, value interface{}) {
+	result, ok := value.(Result)
+	if !ok {
+		r.logger.Error("can't set result cache", zap.String("type", fmt.Sprintf("%T", value)), zap.String("key", key))
+		return
+	}
+	item := cache.Item{ContentType: result.ContentType, ETag: result.ETag, Data: result.Data}
+	if err := r.resultCache.Set(cache.Entity(key), item); err != nil {
+		r.logger.Error("can't set result cache", zap.Error(err), zap.String("key", key))
+	}
+}
+
+// ETag returns the validator of the result without processing the image,
+// so conditional requests cost only a source lookup which is usually cached.
+func (r Service) ETag(ctx context.Context, target string, params Params) (string, error) {
+	if err := r.checkOutputParams(params); err != nil {
+		return "", err
+	}
+
+	srcs, err := r.sources(ctx, target, params)
+	if err != nil {
+		return "", err
+	}
+	return resultETag(srcs.version(), params), nil
+}
+
+// sources gets the target and the images operations load, e.g. overlays.
+func (r Service) sources(ctx context.Context, target string, params Params) (sources, error) {
+	src, err := r.imageProvider.GetImage(ctx, target)
+	if err != nil {
+		return sources{}, errors.Wrap(err, "can't get image")
+	}
+
+	srcs := sources{main: src, loaded: make(map[string]imagestore.Source)}
+	for _, op := range params.Ops {
+		l, ok := op.(loader)
+		if !ok {
+			continue
+		}
+		for _, t := range l.targets() {
+			if _, ok := srcs.loaded[t]; ok {
+				continue
+			}
+			if srcs.loaded[t], err = r.imageProvider.GetImage(ctx, t); err != nil {
+				return sources{}, errors.Wrapf(err, "can't get image %s", t)
+			}
+		}
+	}
+	return srcs, nil
+}
+
+func (r Service) resize(ctx context.Context, srcs sources, params Params) (Result, error) {
+	release, err := r.workers.acquire(ctx)
+	if err != nil {
+		return Result{}, err
+	}
+	// the worker is busy until the work is done or aborted
+	defer release()
+
+	result, err := r.process(ctx, srcs, params)
+	countWork(errors.Cause(err))
+	if err != nil {
+		return Result{}, err
+	}
+	result.ETag = resultETag(srcs.version(), params)
+	return result, nil
+}
+
+// process decodes the source, resizes the image, applies the operations
+// and encodes the result with the metadata.
+func (r Service) process(ctx context.Context, srcs sources, params Params) (Result, error) {
+	src := srcs.main
+	img, srcFormat, err := r.imageDecoder.Decode(src)
+	if err != nil {
+		return Result{}, errors.Wrap(err, "can't decode image")
+	}
+
+	var md metadata.Metadata
+	if params.KeepMetadata {
+		md = metadata.Read(src.Data, srcFormat)
+	}
+
+	out := img
+	if params.Width > 0 || params.Height > 0 {
+		width, height := outputSize(img.Bounds(), params)
+		if err := r.checkOutput(width, height); err != nil {
+			return Result{}, err
+		}
+
+		if out, err = r.ResizeImage(ctx, img, params); err != nil {
+			return Result{}, err
+		}
+	}
+
+	// operations draw the images the version of the result was computed from
+	rt := loadedRuntime{Service: r, loaded: srcs.loaded}
+	out, err = params.Ops.Apply(ctx, rt, out, r.outputLimits)
+	if err != nil {
+		return Result{}, err
+	}
+
+	f := params.Format
+	if f == "" {
+		f = encoder.Negotiate(params.Accept, encoder.HasAlpha(out))
+	}
+
+	buf := &bytes.Buffer{}
+	if err := encoder.Encode(buf, out, f, params.Encoding); err != nil {
+		return Result{}, errors.Wrap(err, "can't encode image")
+	}
+
+	data, err := metadata.Embed(buf.Bytes(), f, md)
+	if err != nil {
+		return Result{}, errors.Wrap(err, "can't embed metadata")
+	}
+
+	return Result{ContentType: f.ContentType(), Data: data}, nil
+}
+
+// ResizeImage resizes with the smart resizer for GravitySmart and with the image resizer otherwise.
+func (r Service) ResizeImage(ctx context.Context, img image.Image, params Params) (image.Image, error) {
+	if params.Gravity == GravitySmart {
+		return r.smartResizer.Resize(ctx, img, params)
+	}
+	return r.imageResizer.Resize(ctx, img, params)
+}
+
+// LoadImage gets and decodes the target, operations use it to load additional images.
+func (r Service) LoadImage(ctx context.Context, target string) (image.Image, error) {
+	src, err := r.imageProvider.GetImage(ctx, target)
 	if err != nil {
 		return nil, errors.Wrap(err, "can't get image")
 	}
+	return r.decodeImage(src)
+}
 
-	type resizeResult struct {
-		ok  image.Image
-		err error
+func (r Service) decodeImage(src imagestore.Source) (image.Image, error) {
+	img, _, err := r.imageDecoder.Decode(src)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't decode image")
 	}
+	return img, nil
+}
 
-	resize := make(chan resizeResult, 1)
-	go func() {
-		defer close(resize)
-		var result resizeResult
-		result.ok, result.err = r.imageResizer.Resize(img, params)
-		resize <- result
-	}()
+// loadedRuntime loads the images got along with the source instead of fetching them again.
+type loadedRuntime struct {
+	Service
+	loaded map[string]imagestore.Source
+}
 
-	select {
-	case result := <-resize:
-		if err := result.err; err != nil {
-			return nil, err
+func (rt loadedRuntime) LoadImage(ctx context.Context, target string) (image.Image, error) {
+	src, ok := rt.loaded[target]
+	if !ok {
+		return rt.Service.LoadImage(ctx, target)
+	}
+	return rt.decodeImage(src)
+}
+
+// checkOutputParams rejects requested dimensions exceeding the configured limits,
+// including the ones of resize operations.
+func (r Service) checkOutputParams(params Params) error {
+	if err := r.checkOutput(params.Width, params.Height); err != nil {
+		return err
+	}
+	for _, op := range params.Ops {
+		if s, ok := op.(sizer); ok {
+			if err := r.checkOutput(s.size()); err != nil {
+				return err
+			}
 		}
-		return result.ok, nil
-	case <-ctx.Done():
-		return nil, ctx.Err()
 	}
+	return nil
+}
+
+// checkOutput rejects output dimensions exceeding the configured limits.
+func (r Service) checkOutput(width, height int) error {
+	if err := r.outputLimits.Check(width, height); err != nil {
+		return invalidParams("%v", err)
+	}
+	return nil
+}
+
+// outputSize returns the upper bound of the output dimensions,
+// deriving a zero dimension from the aspect ratio of the source.
+func outputSize(src image.Rectangle, params Params) (int, int) {
+	width, height := params.Width, params.Height
+	if src.Empty() {
+		return width, height
+	}
+	if width == 0 {
+		width = int(float64(height)*float64(src.Dx())/float64(src.Dy()) + 0.5)
+	}
+	if height == 0 {
+		height = int(float64(width)*float64(src.Dy())/float64(src.Dx()) + 0.5)
+	}
+	return width, height
 }
@@ -3,30 +3,37 @@ package resizer
 import (
 	"bytes"
 	"context"
+	"expvar"
 	"image"
+	"image/color"
 	"image/jpeg"
+	"image/png"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/disintegration/imaging"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 
+	"github.com/ivanovaleksey/resizer/internal/pkg/cache"
+	"github.com/ivanovaleksey/resizer/internal/pkg/format"
+	"github.com/ivanovaleksey/resizer/internal/pkg/imagestore"
+	"github.com/ivanovaleksey/resizer/internal/pkg/metadata"
 	"github.com/ivanovaleksey/resizer/internal/pkg/resizer/mocks"
 	"github.com/ivanovaleksey/resizer/test"
 )
 
 func TestResizer_Resize(t *testing.T) {
 	url := "http://example.com/1.jpg"
-	params := Params{Width: 500, Height: 300}
+	params := Params{Width: 500, Height: 300, Format: format.JPEG}
 
-	srcImage := test.SampleImage(t, 3)
+	src := imagestore.Source{ContentType: "image/jpeg", Data: test.SampleData(t, 3)}
 
-	w := bytes.NewBuffer(nil)
-	err := jpeg.Encode(w, srcImage, nil)
-	require.NoError(t, err)
-
-	imgCfg, err := jpeg.DecodeConfig(w)
+	imgCfg, err := jpeg.DecodeConfig(bytes.NewReader(src.Data))
 	require.NoError(t, err)
 	require.Equal(t, 2560, imgCfg.Width)
 	require.Equal(t, 1920, imgCfg.Height)
@@ -39,13 +46,13 @@ func TestResizer_Resize(t *testing.T) {
 		require.NoError(t, err)
 
 		imageErr := errors.New("some error")
-		imageProvider.On("GetImage", ctx, url).Return(nil, imageErr)
+		imageProvider.On("GetImage", ctx, url).Return(imagestore.Source{}, imageErr)
 
 		out, err := resizer.Resize(ctx, url, params)
 
 		require.Error(t, err)
 		assert.EqualError(t, err, "can't get image: some error")
-		assert.Nil(t, out)
+		assert.Empty(t, out)
 		imageProvider.AssertExpectations(t)
 	})
 
@@ -62,17 +69,42 @@ func TestResizer_Resize(t *testing.T) {
 			resizer, err := NewService(opts...)
 			require.NoError(t, err)
 
-			imageProvider.On("GetImage", ctx, url).Return(srcImage, nil)
+			imageProvider.On("GetImage", ctx, url).Return(src, nil)
 
 			out, err := resizer.Resize(ctx, url, params)
 
 			require.Error(t, err)
 			require.Error(t, ctx.Err())
 			assert.EqualError(t, err, ctx.Err().Error())
-			assert.Nil(t, out)
+			assert.Empty(t, out)
 			imageProvider.AssertExpectations(t)
 		})
 
+		t.Run("with canceled resizing", func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			result := make(chan error, 1)
+
+			imageProvider := &mocks.ImageProvider{}
+			opts := []ServiceOption{
+				WithImageProvider(imageProvider),
+				WithImageResizer(cancelingResizer{cancel: cancel, result: result}),
+			}
+			resizer, err := NewService(opts...)
+			require.NoError(t, err)
+
+			imageProvider.On("GetImage", ctx, url).Return(src, nil)
+
+			aborted := workCount(metricAborted)
+			_, err = resizer.Resize(ctx, url, params)
+			assert.Equal(t, context.Canceled, err)
+
+			assert.Equal(t, context.Canceled, <-result)
+			assert.Eventually(t, func() bool {
+				return workCount(metricAborted) > aborted
+			}, time.Second, 10*time.Millisecond)
+		})
+
 		t.Run("with fast resizing", func(t *testing.T) {
 			ctx := context.Background()
 
@@ -84,32 +116,311 @@ func TestResizer_Resize(t *testing.T) {
 			resizer, err := NewService(opts...)
 			require.NoError(t, err)
 
-			imageProvider.On("GetImage", ctx, url).Return(srcImage, nil)
+			imageProvider.On("GetImage", ctx, url).Return(src, nil)
 
 			out, err := resizer.Resize(ctx, url, params)
 
 			require.NoError(t, err)
-			require.NotNil(t, out)
+			assert.Equal(t, "image/jpeg", out.ContentType)
 
-			buf := bytes.NewBuffer(nil)
-			err = jpeg.Encode(buf, out, nil)
-			require.NoError(t, err)
-
-			outCfg, err := jpeg.DecodeConfig(buf)
+			outCfg, err := jpeg.DecodeConfig(bytes.NewReader(out.Data))
 			require.NoError(t, err)
 			assert.Equal(t, 500, outCfg.Width)
 			assert.Equal(t, 300, outCfg.Height)
 			imageProvider.AssertExpectations(t)
 		})
+
+		t.Run("with the first caller gone", func(t *testing.T) {
+			imageProvider := &mocks.ImageProvider{}
+			opts := []ServiceOption{
+				WithImageProvider(imageProvider),
+				WithImageResizer(sleepyResizer{timeout: 200 * time.Millisecond}),
+			}
+			resizer, err := NewService(opts...)
+			require.NoError(t, err)
+
+			imageProvider.On("GetImage", mock.Anything, url).Return(src, nil)
+
+			first, cancel := context.WithCancel(context.Background())
+			firstErr := make(chan error, 1)
+			go func() {
+				_, err := resizer.Resize(first, url, params)
+				firstErr <- err
+			}()
+			time.Sleep(50 * time.Millisecond)
+
+			second := make(chan error, 1)
+			go func() {
+				_, err := resizer.Resize(context.Background(), url, params)
+				second <- err
+			}()
+			time.Sleep(50 * time.Millisecond)
+
+			cancel()
+			assert.Equal(t, context.Canceled, <-firstErr)
+			assert.NoError(t, <-second)
+			imageProvider.AssertExpectations(t)
+		})
+
+		t.Run("with cached result", func(t *testing.T) {
+			ctx := context.Background()
+
+			imageProvider := &mocks.ImageProvider{}
+			resultCache := mapCache{}
+			opts := []ServiceOption{
+				WithImageProvider(imageProvider),
+				WithImageResizer(NewResizer()),
+				WithResultCache(resultCache),
+			}
+			resizer, err := NewService(opts...)
+			require.NoError(t, err)
+
+			// the source is looked up for its version, it is cached by the provider
+			imageProvider.On("GetImage", ctx, url).Return(src, nil).Twice()
+
+			first, err := resizer.Resize(ctx, url, params)
+			require.NoError(t, err)
+			second, err := resizer.Resize(ctx, url, params)
+			require.NoError(t, err)
+
+			assert.Equal(t, first, second)
+			assert.Len(t, resultCache, 1)
+			imageProvider.AssertExpectations(t)
+		})
+
+		t.Run("with changed source", func(t *testing.T) {
+			ctx := context.Background()
+
+			imageProvider := &mocks.ImageProvider{}
+			resultCache := mapCache{}
+			opts := []ServiceOption{
+				WithImageProvider(imageProvider),
+				WithImageResizer(NewResizer()),
+				WithResultCache(resultCache),
+			}
+			resizer, err := NewService(opts...)
+			require.NoError(t, err)
+
+			v1 := src
+			v1.ETag = `"v1"`
+			v2 := imagestore.Source{ContentType: "image/jpeg", ETag: `"v2"`, Data: test.SampleData(t, 3)}
+			imageProvider.On("GetImage", ctx, url).Return(v1, nil).Once()
+			imageProvider.On("GetImage", ctx, url).Return(v2, nil).Once()
+
+			first, err := resizer.Resize(ctx, url, params)
+			require.NoError(t, err)
+			second, err := resizer.Resize(ctx, url, params)
+			require.NoError(t, err)
+
+			assert.NotEqual(t, first.ETag, second.ETag)
+			assert.Len(t, resultCache, 2)
+			imageProvider.AssertExpectations(t)
+		})
+
+		t.Run("with changed overlay", func(t *testing.T) {
+			ctx := context.Background()
+
+			imageProvider := &mocks.ImageProvider{}
+			resultCache := mapCache{}
+			opts := []ServiceOption{
+				WithImageProvider(imageProvider),
+				WithImageResizer(NewResizer()),
+				WithResultCache(resultCache),
+			}
+			resizer, err := NewService(opts...)
+			require.NoError(t, err)
+
+			ops, err := ParsePipeline("overlay:logo.png")
+			require.NoError(t, err)
+			params := params
+			params.Ops = ops
+
+			red := overlaySource(t, color.NRGBA{R: 255, A: 255}, `"red"`)
+			blue := overlaySource(t, color.NRGBA{B: 255, A: 255}, `"blue"`)
+			imageProvider.On("GetImage", ctx, url).Return(src, nil)
+			imageProvider.On("GetImage", ctx, "logo.png").Return(red, nil).Once()
+			imageProvider.On("GetImage", ctx, "logo.png").Return(blue, nil)
+
+			first, err := resizer.Resize(ctx, url, params)
+			require.NoError(t, err)
+			second, err := resizer.Resize(ctx, url, params)
+			require.NoError(t, err)
+
+			assert.NotEqual(t, first.ETag, second.ETag)
+			assert.NotEqual(t, first.Data, second.Data)
+			assert.Len(t, resultCache, 2)
+
+			etag, err := resizer.ETag(ctx, url, params)
+			require.NoError(t, err)
+			assert.Equal(t, second.ETag, etag)
+		})
+
+		t.Run("with concurrent identical calls", func(t *testing.T) {
+			ctx := context.Background()
+
+			imageProvider := &mocks.ImageProvider{}
+			imageResizer := &countingResizer{sleepyResizer: sleepyResizer{timeout: 100 * time.Millisecond}}
+			opts := []ServiceOption{
+				WithImageProvider(imageProvider),
+				WithImageResizer(imageResizer),
+			}
+			resizer, err := NewService(opts...)
+			require.NoError(t, err)
+
+			imageProvider.On("GetImage", ctx, url).Return(src, nil)
+
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_, err := resizer.Resize(ctx, url, params)
+					assert.NoError(t, err)
+				}()
+			}
+			wg.Wait()
+
+			assert.EqualValues(t, 1, atomic.LoadInt32(&imageResizer.calls))
+			imageProvider.AssertExpectations(t)
+		})
+
+		t.Run("with metadata", func(t *testing.T) {
+			ctx := context.Background()
+
+			imageProvider := &mocks.ImageProvider{}
+			resizer, err := NewService(WithImageProvider(imageProvider), WithImageResizer(Resizer{}))
+			require.NoError(t, err)
+
+			imageProvider.On("GetImage", ctx, url).Return(src, nil)
+
+			profile := metadata.Read(src.Data, format.JPEG).ICCProfile
+			require.NotEmpty(t, profile)
+
+			stripped, err := resizer.Resize(ctx, url, params)
+			require.NoError(t, err)
+			assert.Equal(t, metadata.Metadata{}, metadata.Read(stripped.Data, format.JPEG))
+
+			keep := params
+			keep.KeepMetadata = true
+			kept, err := resizer.Resize(ctx, url, keep)
+			require.NoError(t, err)
+			assert.Equal(t, profile, metadata.Read(kept.Data, format.JPEG).ICCProfile)
+			assert.NotEqual(t, stripped.ETag, kept.ETag)
+		})
+
+		t.Run("with output exceeding limits", func(t *testing.T) {
+			ctx := context.Background()
+
+			imageProvider := &mocks.ImageProvider{}
+			opts := []ServiceOption{
+				WithImageProvider(imageProvider),
+				WithImageResizer(Resizer{}),
+				WithOutputLimits(imagestore.Limits{MaxWidth: 1000, MaxHeight: 600}),
+			}
+			resizer, err := NewService(opts...)
+			require.NoError(t, err)
+
+			imageProvider.On("GetImage", ctx, url).Return(src, nil).Once()
+
+			_, err = resizer.Resize(ctx, url, Params{Width: 2000, Height: 100, Format: format.JPEG})
+			assert.Equal(t, ErrInvalidParams, errors.Cause(err))
+
+			// the height derived from the 4:3 source is 750
+			_, err = resizer.Resize(ctx, url, Params{Width: 1000, Format: format.JPEG})
+			assert.Equal(t, ErrInvalidParams, errors.Cause(err))
+			imageProvider.AssertExpectations(t)
+		})
 	})
 }
 
+func TestService_ETag(t *testing.T) {
+	ctx := context.Background()
+	url := "http://example.com/1.jpg"
+	src := imagestore.Source{ContentType: "image/jpeg", ETag: "etag:\"v1\"", Data: test.SampleData(t, 3)}
+
+	imageProvider := &mocks.ImageProvider{}
+	imageProvider.On("GetImage", ctx, url).Return(src, nil)
+
+	// the dummy resizer would break Resize, ETag must not need it
+	service, err := NewService(WithImageProvider(imageProvider))
+	require.NoError(t, err)
+
+	etag, err := service.ETag(ctx, url, Params{Width: 100})
+	require.NoError(t, err)
+	assert.Regexp(t, `^"[0-9a-f]{32}"$`, etag)
+
+	same, err := service.ETag(ctx, url, Params{Width: 100, Mode: ModeStretch})
+	require.NoError(t, err)
+	assert.Equal(t, etag, same)
+
+	other, err := service.ETag(ctx, url, Params{Width: 200})
+	require.NoError(t, err)
+	assert.NotEqual(t, etag, other)
+}
+
+func overlaySource(t *testing.T, c color.NRGBA, etag string) imagestore.Source {
+	buf := &bytes.Buffer{}
+	require.NoError(t, png.Encode(buf, imaging.New(20, 20, c)))
+	return imagestore.Source{ContentType: "image/png", ETag: etag, Data: buf.Bytes()}
+}
+
+type mapCache map[cache.Entity]cache.Item
+
+func (m mapCache) Get(key cache.Entity) (cache.Item, error) {
+	item, ok := m[key]
+	if !ok {
+		return cache.Item{}, cache.ErrCacheMiss
+	}
+	return item, nil
+}
+
+func (m mapCache) Set(key cache.Entity, item cache.Item) error {
+	m[key] = item
+	return nil
+}
+
 type sleepyResizer struct {
 	timeout time.Duration
 	Resizer
 }
 
-func (s sleepyResizer) Resize(img image.Image, params Params) (image.Image, error) {
-	<-time.After(s.timeout)
-	return s.Resizer.Resize(img, params)
+func (s sleepyResizer) Resize(ctx context.Context, img image.Image, params Params) (image.Image, error) {
+	select {
+	case <-time.After(s.timeout):
+	case <-ctx.Done():
+	}
+	return s.Resizer.Resize(ctx, img, params)
+}
+
+type countingResizer struct {
+	calls int32 // atomic access
+	sleepyResizer
+}
+
+func (c *countingResizer) Resize(ctx context.Context, img image.Image, params Params) (image.Image, error) {
+	atomic.AddInt32(&c.calls, 1)
+	return c.sleepyResizer.Resize(ctx, img, params)
+}
+
+// cancelingResizer cancels the request once resizing starts, waits for the work to be abandoned
+// and reports the result of resizing.
+type cancelingResizer struct {
+	cancel context.CancelFunc
+	result chan error
+	Resizer
+}
+
+func (c cancelingResizer) Resize(ctx context.Context, img image.Image, params Params) (image.Image, error) {
+	c.cancel()
+	<-ctx.Done()
+	out, err := c.Resizer.Resize(ctx, img, params)
+	c.result <- err
+	return out, err
+}
+
+func workCount(outcome string) int64 {
+	if v, ok := metrics.Get(outcome).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
 }
@@ -0,0 +1,134 @@
+package resizer
+
+import (
+	"context"
+	"image"
+	"math"
+
+	"github.com/disintegration/imaging"
+)
+
+// analysisSize is the maximum side of the downscaled copy used to score crop windows.
+const analysisSize = 128
+
+// SmartResizer crops the image to the window with the highest edge density.
+// It is used for GravitySmart and falls back to Resizer for everything else.
+type SmartResizer struct {
+	Resizer
+}
+
+func NewSmartResizer() SmartResizer {
+	return SmartResizer{Resizer: NewResizer()}
+}
+
+func (r SmartResizer) Resize(ctx context.Context, img image.Image, params Params) (image.Image, error) {
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+	if params.Gravity != GravitySmart || params.Mode != ModeFill || params.Width == 0 || params.Height == 0 {
+		return r.Resizer.Resize(ctx, img, params)
+	}
+
+	crop := smartCrop(img, params.Width, params.Height)
+	return resample(ctx, imaging.Crop(img, crop), params.Width, params.Height)
+}
+
+// smartCrop returns the largest rectangle with the target aspect ratio
+// which covers the most edges of the image.
+// The result depends only on the pixels, so it is stable between runs.
+func smartCrop(img image.Image, width, height int) image.Rectangle {
+	bounds := img.Bounds()
+	center := focalCrop(bounds, width, height, FocalPoint{X: 0.5, Y: 0.5})
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+	if center.Dx() == srcW && center.Dy() == srcH {
+		return center
+	}
+
+	scale := math.Min(1, float64(analysisSize)/float64(maxInt(srcW, srcH)))
+	sampleW := maxInt(1, int(float64(srcW)*scale+0.5))
+	sampleH := maxInt(1, int(float64(srcH)*scale+0.5))
+	sample := imaging.Grayscale(imaging.Resize(img, sampleW, sampleH, imaging.Box))
+
+	energy := edgeEnergy(sample)
+
+	windowW := clampInt(int(float64(center.Dx())*float64(sampleW)/float64(srcW)+0.5), 1, sampleW)
+	windowH := clampInt(int(float64(center.Dy())*float64(sampleH)/float64(srcH)+0.5), 1, sampleH)
+
+	centerX, centerY := (sampleW-windowW)/2, (sampleH-windowH)/2
+	bestX, bestY, bestScore := centerX, centerY, energy.sum(centerX, centerY, windowW, windowH)
+	bestDistance := 0
+	for y := 0; y <= sampleH-windowH; y++ {
+		for x := 0; x <= sampleW-windowW; x++ {
+			score := energy.sum(x, y, windowW, windowH)
+			distance := absInt(x-centerX) + absInt(y-centerY)
+			if score > bestScore || score == bestScore && distance < bestDistance {
+				bestX, bestY, bestScore, bestDistance = x, y, score, distance
+			}
+		}
+	}
+
+	if bestX == centerX && bestY == centerY {
+		return center
+	}
+
+	x := scalePosition(bestX, sampleW-windowW, srcW-center.Dx())
+	y := scalePosition(bestY, sampleH-windowH, srcH-center.Dy())
+
+	return image.Rect(x, y, x+center.Dx(), y+center.Dy()).Add(bounds.Min)
+}
+
+// scalePosition maps a window offset within [0, from] onto [0, to].
+func scalePosition(pos, from, to int) int {
+	if from == 0 {
+		return to / 2
+	}
+	return int(float64(pos)*float64(to)/float64(from) + 0.5)
+}
+
+// integralImage holds prefix sums, so a sum over any rectangle costs O(1).
+type integralImage struct {
+	stride int
+	values []int64
+}
+
+func (ii integralImage) sum(x, y, w, h int) int64 {
+	at := func(x, y int) int64 { return ii.values[y*ii.stride+x] }
+	return at(x+w, y+h) - at(x, y+h) - at(x+w, y) + at(x, y)
+}
+
+// edgeEnergy calculates the gradient magnitude of a grayscale image.
+func edgeEnergy(gray *image.NRGBA) integralImage {
+	w, h := gray.Rect.Dx(), gray.Rect.Dy()
+	lum := func(x, y int) int64 { return int64(gray.Pix[y*gray.Stride+x*4]) }
+
+	ii := integralImage{stride: w + 1, values: make([]int64, (w+1)*(h+1))}
+	for y := 0; y < h; y++ {
+		var row int64
+		for x := 0; x < w; x++ {
+			var e int64
+			if x+1 < w {
+				e += absInt64(lum(x+1, y) - lum(x, y))
+			}
+			if y+1 < h {
+				e += absInt64(lum(x, y+1) - lum(x, y))
+			}
+			row += e
+			ii.values[(y+1)*ii.stride+x+1] = ii.values[y*ii.stride+x+1] + row
+		}
+	}
+	return ii
+}
+
+func absInt(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func absInt64(x int64) int64 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,66 @@
+package resizer
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/disintegration/imaging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ivanovaleksey/resizer/test"
+)
+
+func TestSmartResizer_Resize(t *testing.T) {
+	t.Run("it picks the detailed region", func(t *testing.T) {
+		// flat gray image with a checkerboard at the right edge
+		srcImage := imaging.New(300, 100, color.NRGBA{R: 128, G: 128, B: 128, A: 255})
+		for y := 0; y < 100; y++ {
+			for x := 220; x < 300; x++ {
+				if (x/4+y/4)%2 == 0 {
+					srcImage.Set(x, y, color.Black)
+				}
+			}
+		}
+
+		assert.Equal(t, image.Rect(200, 0, 300, 100), smartCrop(srcImage, 50, 50))
+
+		params := Params{Width: 50, Height: 50, Mode: ModeFill, Gravity: GravitySmart}
+		out, err := NewSmartResizer().Resize(context.Background(), srcImage, params)
+		require.NoError(t, err)
+		assert.Equal(t, image.Rect(0, 0, 50, 50), out.Bounds())
+	})
+
+	t.Run("it prefers the center of a flat image", func(t *testing.T) {
+		srcImage := imaging.New(300, 100, color.White)
+		assert.Equal(t, image.Rect(100, 0, 200, 100), smartCrop(srcImage, 50, 50))
+	})
+
+	t.Run("it picks the detailed region of a photo", func(t *testing.T) {
+		// 2560x1920 photo: mountains over a smooth lake, with grassy slopes on the left
+		srcImage := test.SampleImage(t, 3)
+
+		// the slopes rather than the lake and the sky in the center
+		assert.Equal(t, image.Rect(0, 0, 1152, 1920), smartCrop(srcImage, 300, 500))
+		// the mountain ridge rather than the shore in the middle
+		assert.Equal(t, image.Rect(0, 483, 2560, 995), smartCrop(srcImage, 1000, 200))
+	})
+
+	t.Run("it picks the region made detailed", func(t *testing.T) {
+		srcImage := imaging.Clone(test.SampleImage(t, 3))
+		// a checkerboard strip over the right side of the lake
+		for y := 0; y < 1920; y++ {
+			for x := 2160; x < 2560; x++ {
+				if (x/16+y/16)%2 == 0 {
+					srcImage.Set(x, y, color.Black)
+				} else {
+					srcImage.Set(x, y, color.White)
+				}
+			}
+		}
+
+		assert.Equal(t, image.Rect(1408, 0, 2560, 1920), smartCrop(srcImage, 300, 500))
+	})
+}
@@ -0,0 +1,28 @@
+package singleflight
+
+import (
+	"context"
+	"time"
+)
+
+// detachedContext keeps the values of the parent but not its cancellation,
+// so the shared fetch outlives the caller which started it.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+func (c detachedContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
@@ -2,27 +2,29 @@ package singleflight
 
 import (
 	"context"
-	"image"
 
 	"github.com/ivanovaleksey/resizer/internal/pkg/cache"
+	"github.com/ivanovaleksey/resizer/internal/pkg/imagestore"
 )
 
 type dummyImageProvider struct {
 }
 
-func (d dummyImageProvider) GetImage(ctx context.Context, target string) (image.Image, error) {
-	return nil, nil
+func (d dummyImageProvider) GetImage(ctx context.Context, target string) (imagestore.Source, error) {
+	return imagestore.Source{}, nil
 }
 
 type dummyCacheProvider struct {
 }
 
-func (d dummyCacheProvider) Get(cache.Entity) (image.Image, error) {
-	return nil, nil
+func (d dummyCacheProvider) Get(cache.Entity) (cache.Item, error) {
+	return cache.Item{}, cache.ErrCacheMiss
 }
 
-func (d dummyCacheProvider) Set(cache.Entity, image.Image) error {
+func (d dummyCacheProvider) Set(cache.Entity, cache.Item) error {
 	return nil
 }
 
-
+func (d dummyCacheProvider) Delete(cache.Entity) error {
+	return nil
+}
@@ -0,0 +1,173 @@
+package singleflight
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/cespare/xxhash"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const bucketsCount = 256
+
+// Func computes the value of a key. Its context is detached from the callers,
+// it is bounded by the group timeout and cancelled when all the callers have gone.
+type Func func(ctx context.Context) (interface{}, error)
+
+// Group deduplicates concurrent computations of the same key, e.g. source fetches or resize results.
+// Keys are spread over buckets by xxhash, so unrelated keys rarely contend for a lock.
+// Keys are strings and values are interface{} since Go 1.12 has no generics: one Group serves
+// sources and resize results alike. Callers assert values back to the type their Func returns
+// with the checked form, so a mistake is an error rather than a panic.
+type Group struct {
+	locks   [bucketsCount]sync.Mutex
+	buckets [bucketsCount]map[string]*call
+
+	name    string
+	logger  *zap.Logger
+	timeout time.Duration
+	commit  func(key string, value interface{})
+}
+
+type GroupOption func(*Group)
+
+// WithGroupTimeout bounds computations, zero means no timeout.
+func WithGroupTimeout(timeout time.Duration) GroupOption {
+	return func(g *Group) {
+		g.timeout = timeout
+	}
+}
+
+// WithCommit sets the function storing successful results, e.g. in a cache.
+// It is called under the bucket lock and only for calls which are not forgotten,
+// so a stale result never overwrites a newer one.
+func WithCommit(commit func(key string, value interface{})) GroupOption {
+	return func(g *Group) {
+		g.commit = commit
+	}
+}
+
+func WithGroupLogger(logger *zap.Logger) GroupOption {
+	return func(g *Group) {
+		g.logger = logger
+	}
+}
+
+// NewGroup creates a group, the name identifies it in logs and errors.
+func NewGroup(name string, opts ...GroupOption) *Group {
+	g := &Group{
+		name:   name,
+		logger: zap.NewNop(),
+		commit: func(string, interface{}) {},
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	return g
+}
+
+type call struct {
+	value interface{}
+	err   error
+	ready chan struct{}
+
+	waiters int // guarded by the bucket lock
+	cancel  context.CancelFunc
+}
+
+// Do runs fn once for all the concurrent callers with the same key.
+// Each caller returns as soon as its context is done.
+func (g *Group) Do(ctx context.Context, key string, fn Func) (interface{}, error) {
+	// don't start work nobody waits for
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	idx := bucketIndex(key)
+
+	lock := &g.locks[idx]
+	lock.Lock()
+
+	if g.buckets[idx] == nil {
+		g.buckets[idx] = make(map[string]*call)
+	}
+	bucket := g.buckets[idx]
+
+	c, ok := bucket[key]
+	if !ok {
+		callCtx, cancel := g.detach(ctx)
+		c = &call{ready: make(chan struct{}), cancel: cancel}
+		bucket[key] = c
+		go g.run(callCtx, idx, key, c, fn)
+	}
+	c.waiters++
+	lock.Unlock()
+
+	select {
+	case <-c.ready:
+	case <-ctx.Done():
+		lock.Lock()
+		c.waiters--
+		if c.waiters == 0 {
+			c.cancel()
+			if bucket[key] == c {
+				delete(bucket, key)
+			}
+		}
+		lock.Unlock()
+		return nil, ctx.Err()
+	}
+
+	return c.value, c.err
+}
+
+// Forget detaches the key from the call in flight, so the next call computes it again.
+// Callers already waiting get the result of the old call, which is not committed.
+func (g *Group) Forget(key string) {
+	idx := bucketIndex(key)
+
+	lock := &g.locks[idx]
+	lock.Lock()
+	delete(g.buckets[idx], key)
+	lock.Unlock()
+}
+
+// detach returns the context of a call, it keeps the values of the caller but not its cancellation.
+func (g *Group) detach(ctx context.Context) (context.Context, context.CancelFunc) {
+	if g.timeout > 0 {
+		return context.WithTimeout(detachedContext{parent: ctx}, g.timeout)
+	}
+	return context.WithCancel(detachedContext{parent: ctx})
+}
+
+// run computes the value of the call and removes the call once the value is committed.
+// A panic of fn is returned to the waiters as an error.
+func (g *Group) run(ctx context.Context, idx uint64, key string, c *call, fn Func) {
+	defer func() {
+		if r := recover(); r != nil {
+			g.logger.Error(g.name+" panicked", zap.Any("panic", r), zap.Stack("stack"), zap.String("key", key))
+			c.value, c.err = nil, errors.Errorf("%s panicked: %v", g.name, r)
+		}
+
+		lock := &g.locks[idx]
+		lock.Lock()
+		if g.buckets[idx][key] == c {
+			delete(g.buckets[idx], key)
+			if c.err == nil {
+				g.commit(key, c.value)
+			}
+		}
+		lock.Unlock()
+
+		c.cancel()
+		close(c.ready)
+	}()
+
+	c.value, c.err = fn(ctx)
+}
+
+func bucketIndex(key string) uint64 {
+	return xxhash.Sum64String(key) % bucketsCount
+}
@@ -0,0 +1,99 @@
+package singleflight
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroup_Do(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("it computes a key once and commits the value", func(t *testing.T) {
+		var committed sync.Map
+		g := NewGroup("test", WithCommit(func(key string, value interface{}) {
+			committed.Store(key, value)
+		}))
+
+		var calls int32
+		fn := func(ctx context.Context) (interface{}, error) {
+			atomic.AddInt32(&calls, 1)
+			time.Sleep(50 * time.Millisecond)
+			return 42, nil
+		}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 100; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				value, err := g.Do(ctx, "answer", fn)
+				assert.NoError(t, err)
+				assert.Equal(t, 42, value)
+			}()
+		}
+		wg.Wait()
+
+		assert.EqualValues(t, 1, atomic.LoadInt32(&calls))
+		value, ok := committed.Load("answer")
+		require.True(t, ok)
+		assert.Equal(t, 42, value)
+	})
+
+	t.Run("it doesn't commit forgotten calls", func(t *testing.T) {
+		var commits int32
+		g := NewGroup("test", WithCommit(func(string, interface{}) {
+			atomic.AddInt32(&commits, 1)
+		}))
+
+		started := make(chan struct{})
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			_, err := g.Do(ctx, "key", func(ctx context.Context) (interface{}, error) {
+				close(started)
+				time.Sleep(50 * time.Millisecond)
+				return "stale", nil
+			})
+			assert.NoError(t, err)
+		}()
+		<-started
+
+		g.Forget("key")
+		value, err := g.Do(ctx, "key", func(ctx context.Context) (interface{}, error) {
+			return "fresh", nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "fresh", value)
+
+		<-done
+		assert.EqualValues(t, 1, atomic.LoadInt32(&commits))
+	})
+
+	t.Run("it returns panics as errors", func(t *testing.T) {
+		g := NewGroup("test")
+
+		_, err := g.Do(ctx, "key", func(ctx context.Context) (interface{}, error) {
+			panic("boom")
+		})
+		assert.EqualError(t, err, "test panicked: boom")
+	})
+
+	t.Run("it doesn't start calls for done contexts", func(t *testing.T) {
+		g := NewGroup("test")
+
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+
+		_, err := g.Do(ctx, "key", func(ctx context.Context) (interface{}, error) {
+			t.Error("unexpected call")
+			return nil, nil
+		})
+		assert.Equal(t, context.Canceled, err)
+	})
+}
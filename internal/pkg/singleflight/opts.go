@@ -1,6 +1,10 @@
 package singleflight
 
-import "go.uber.org/zap"
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
 
 type Option func(*SingleFlight)
 
@@ -16,6 +20,13 @@ func WithCacheProvider(provider CacheProvider) Option {
 	}
 }
 
+// WithTimeout bounds shared fetches, they don't depend on the contexts of callers.
+func WithTimeout(timeout time.Duration) Option {
+	return func(s *SingleFlight) {
+		s.timeout = timeout
+	}
+}
+
 func WithLogger(logger *zap.Logger) Option {
 	return func(s *SingleFlight) {
 		s.logger = logger
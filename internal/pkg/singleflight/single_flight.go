@@ -2,33 +2,37 @@ package singleflight
 
 import (
 	"context"
-	"image"
-	"sync"
+	"fmt"
+	"time"
 
-	"github.com/cespare/xxhash"
+	"github.com/pkg/errors"
 	"go.uber.org/zap"
 
 	"github.com/ivanovaleksey/resizer/internal/pkg/cache"
+	"github.com/ivanovaleksey/resizer/internal/pkg/imagestore"
 )
 
-const bucketsCount = 256
+// DefaultTimeout is the default limit of a shared fetch.
+const DefaultTimeout = 10 * time.Second
 
+// SingleFlight is an image provider caching images and fetching each one once for concurrent callers.
 type SingleFlight struct {
-	locks   [bucketsCount]sync.Mutex
-	buckets [bucketsCount]map[cache.Entity]*Entry
+	group *Group
 
 	logger        *zap.Logger
 	cache         CacheProvider
 	imageProvider ImageProvider
+	timeout       time.Duration
 }
 
 type CacheProvider interface {
-	Get(cache.Entity) (image.Image, error)
-	Set(cache.Entity, image.Image) error
+	Get(cache.Entity) (cache.Item, error)
+	Set(cache.Entity, cache.Item) error
+	Delete(cache.Entity) error
 }
 
 type ImageProvider interface {
-	GetImage(ctx context.Context, target string) (image.Image, error)
+	GetImage(ctx context.Context, target string) (imagestore.Source, error)
 }
 
 func NewSingleFlight(opts ...Option) *SingleFlight {
@@ -36,26 +40,30 @@ func NewSingleFlight(opts ...Option) *SingleFlight {
 		logger:        zap.NewNop(),
 		cache:         dummyCacheProvider{},
 		imageProvider: dummyImageProvider{},
+		timeout:       DefaultTimeout,
 	}
 	for _, opt := range opts {
 		opt(s)
 	}
-	return s
-}
 
-type Entry struct {
-	ok    image.Image
-	err   error
-	ready chan struct{}
+	s.group = NewGroup("image provider",
+		WithGroupTimeout(s.timeout),
+		WithGroupLogger(s.logger),
+		WithCommit(s.store),
+	)
+	return s
 }
 
-func (s *SingleFlight) GetImage(ctx context.Context, target string) (image.Image, error) {
+// GetImage returns the cached image or fetches it once for all the concurrent callers.
+// The fetch runs on a detached context with its own timeout and it is cancelled
+// only when every caller has gone, while each caller returns as soon as its context is done.
+func (s *SingleFlight) GetImage(ctx context.Context, target string) (imagestore.Source, error) {
 	e := cache.Entity(target)
 
 	value, err := s.cache.Get(e)
-	if value != nil {
+	if err == nil {
 		s.logger.Debug("cache hit")
-		return value, nil
+		return imagestore.Source{ContentType: value.ContentType, ETag: value.ETag, Data: value.Data}, nil
 	}
 
 	if err == cache.ErrCacheMiss {
@@ -65,41 +73,44 @@ func (s *SingleFlight) GetImage(ctx context.Context, target string) (image.Image
 		s.logger.Error("can't get cache", zap.Error(err), zap.String("key", e.Key()))
 	}
 
-	idx := xxhash.Sum64([]byte(e)) % bucketsCount
-
-	lock := &s.locks[idx]
-	lock.Lock()
-
-	if s.buckets[idx] == nil {
-		s.buckets[idx] = make(map[cache.Entity]*Entry)
+	fetched, err := s.group.Do(ctx, e.Key(), func(ctx context.Context) (interface{}, error) {
+		// the previous fetch may have been cached after the lookup above
+		if value, err := s.cache.Get(e); err == nil {
+			return imagestore.Source{ContentType: value.ContentType, ETag: value.ETag, Data: value.Data}, nil
+		}
+		return s.imageProvider.GetImage(ctx, target)
+	})
+	if err != nil {
+		return imagestore.Source{}, err
 	}
-	bucket := s.buckets[idx]
 
-	entry, ok := bucket[e]
+	src, ok := fetched.(imagestore.Source)
 	if !ok {
-		entry = &Entry{ready: make(chan struct{})}
-		bucket[e] = entry
-		lock.Unlock()
-
-		entry.ok, entry.err = s.imageProvider.GetImage(ctx, target)
-		close(entry.ready)
-		if entry.err == nil {
-			if err := s.cache.Set(e, entry.ok); err != nil {
-				s.logger.Error("can't set cache", zap.Error(err), zap.String("key", e.Key()))
-			}
-		}
-
-		lock.Lock()
-		delete(bucket, e)
-		lock.Unlock()
-	} else {
-		lock.Unlock()
-		<-entry.ready
+		return imagestore.Source{}, errors.Errorf("unexpected %T fetched for %s", fetched, target)
 	}
+	return src, nil
+}
+
+// Forget drops the cached image of the target and detaches it from the fetch in flight,
+// so the next call fetches it again. Callers already waiting get the result of the old fetch.
+// Resize results are keyed by the version of the source, so a changed image is served afterwards.
+func (s *SingleFlight) Forget(target string) {
+	e := cache.Entity(target)
 
-	if err := entry.err; err != nil {
-		return nil, err
+	s.group.Forget(e.Key())
+	if err := s.cache.Delete(e); err != nil {
+		s.logger.Error("can't delete cache", zap.Error(err), zap.String("key", e.Key()))
 	}
+}
 
-	return entry.ok, nil
+func (s *SingleFlight) store(key string, value interface{}) {
+	src, ok := value.(imagestore.Source)
+	if !ok {
+		s.logger.Error("can't set cache", zap.String("type", fmt.Sprintf("%T", value)), zap.String("key", key))
+		return
+	}
+	item := cache.Item{ContentType: src.ContentType, ETag: src.ETag, Data: src.Data}
+	if err := s.cache.Set(cache.Entity(key), item); err != nil {
+		s.logger.Error("can't set cache", zap.Error(err), zap.String("key", key))
+	}
 }
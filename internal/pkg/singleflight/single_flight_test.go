@@ -2,7 +2,6 @@ package singleflight
 
 import (
 	"context"
-	"image"
 	"strconv"
 	"sync"
 	"sync/atomic"
@@ -12,6 +11,7 @@ import (
 	"github.com/stretchr/testify/assert"
 
 	"github.com/ivanovaleksey/resizer/internal/pkg/cache"
+	"github.com/ivanovaleksey/resizer/internal/pkg/imagestore"
 	"github.com/ivanovaleksey/resizer/test"
 )
 
@@ -24,7 +24,7 @@ func TestSingleFlight_GetImage(t *testing.T) {
 	t.Run("it waits for in-flight calls", func(t *testing.T) {
 		ctx := context.Background()
 
-		imageCache := &simpleImageCache{m: make(map[cache.Entity]image.Image)}
+		imageCache := &simpleImageCache{m: make(map[cache.Entity]cache.Item)}
 		imageProvider := newImageProvider(t)
 		opts := []Option{
 			WithCacheProvider(imageCache),
@@ -49,7 +49,7 @@ func TestSingleFlight_GetImage(t *testing.T) {
 	t.Run("it serves from cache", func(t *testing.T) {
 		ctx := context.Background()
 
-		imageCache := &simpleImageCache{m: make(map[cache.Entity]image.Image)}
+		imageCache := &simpleImageCache{m: make(map[cache.Entity]cache.Item)}
 		imageProvider := newImageProvider(t)
 		opts := []Option{
 			WithCacheProvider(imageCache),
@@ -84,7 +84,7 @@ func TestSingleFlight_GetImage(t *testing.T) {
 		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
 		defer cancel()
 
-		imageCache := &simpleImageCache{m: make(map[cache.Entity]image.Image)}
+		imageCache := &simpleImageCache{m: make(map[cache.Entity]cache.Item)}
 		imageProvider := newImageProvider(t)
 		imageProvider.timeout = 300 * time.Millisecond
 		opts := []Option{
@@ -117,24 +117,180 @@ func TestSingleFlight_GetImage(t *testing.T) {
 	})
 }
 
+func TestSingleFlight_Cancellation(t *testing.T) {
+	const url = "http://example.com/1.jpg"
+
+	t.Run("it serves waiters when the first caller is gone", func(t *testing.T) {
+		imageProvider := newImageProvider(t)
+		s := NewSingleFlight(WithImageProvider(imageProvider))
+
+		first, cancel := context.WithCancel(context.Background())
+		firstErr := make(chan error, 1)
+		go func() {
+			_, err := s.GetImage(first, url)
+			firstErr <- err
+		}()
+		time.Sleep(10 * time.Millisecond)
+
+		second := make(chan error, 1)
+		go func() {
+			_, err := s.GetImage(context.Background(), url)
+			second <- err
+		}()
+		time.Sleep(10 * time.Millisecond)
+
+		cancel()
+		assert.Equal(t, context.Canceled, <-firstErr)
+		assert.NoError(t, <-second)
+		assert.EqualValues(t, 1, imageProvider.Counter())
+	})
+
+	t.Run("it returns a waiter early on its context", func(t *testing.T) {
+		imageProvider := newImageProvider(t)
+		imageProvider.timeout = time.Second
+		s := NewSingleFlight(WithImageProvider(imageProvider))
+
+		go s.GetImage(context.Background(), url)
+		time.Sleep(10 * time.Millisecond)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		_, err := s.GetImage(ctx, url)
+		assert.Equal(t, context.DeadlineExceeded, err)
+		assert.True(t, time.Since(start) < 500*time.Millisecond)
+	})
+
+	t.Run("it cancels the fetch when all waiters are gone", func(t *testing.T) {
+		imageProvider := &blockingImageProvider{done: make(chan error, 1)}
+		s := NewSingleFlight(WithImageProvider(imageProvider))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s.GetImage(ctx, url)
+			}()
+		}
+		wg.Wait()
+
+		select {
+		case err := <-imageProvider.done:
+			assert.Equal(t, context.Canceled, err)
+		case <-time.After(time.Second):
+			t.Fatal("fetch is not cancelled")
+		}
+	})
+
+	t.Run("it limits the fetch by its own timeout", func(t *testing.T) {
+		imageProvider := &blockingImageProvider{done: make(chan error, 1)}
+		s := NewSingleFlight(WithImageProvider(imageProvider), WithTimeout(50*time.Millisecond))
+
+		_, err := s.GetImage(context.Background(), url)
+		assert.Equal(t, context.DeadlineExceeded, err)
+	})
+}
+
+func TestSingleFlight_Panic(t *testing.T) {
+	const url = "http://example.com/1.jpg"
+
+	imageProvider := &panickingImageProvider{}
+	s := NewSingleFlight(WithImageProvider(imageProvider))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.GetImage(context.Background(), url)
+			assert.EqualError(t, err, "image provider panicked: boom")
+		}()
+	}
+	wg.Wait()
+
+	imageProvider.recovered = true
+	_, err := s.GetImage(context.Background(), url)
+	assert.NoError(t, err)
+}
+
+func TestSingleFlight_Forget(t *testing.T) {
+	const url = "http://example.com/1.jpg"
+	ctx := context.Background()
+
+	imageCache := &simpleImageCache{m: make(map[cache.Entity]cache.Item)}
+	imageProvider := newImageProvider(t)
+	s := NewSingleFlight(WithCacheProvider(imageCache), WithImageProvider(imageProvider))
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, err := s.GetImage(ctx, url)
+		assert.NoError(t, err)
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	// the fetch in flight is not shared after Forget
+	s.Forget(url)
+	_, err := s.GetImage(ctx, url)
+	assert.NoError(t, err)
+	wg.Wait()
+	assert.EqualValues(t, 2, imageProvider.Counter())
+
+	// the cached image is dropped
+	s.Forget(url)
+	assert.Empty(t, imageCache.m)
+	_, err = s.GetImage(ctx, url)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, imageProvider.Counter())
+}
+
+type panickingImageProvider struct {
+	recovered bool
+}
+
+func (p *panickingImageProvider) GetImage(ctx context.Context, target string) (imagestore.Source, error) {
+	if !p.recovered {
+		time.Sleep(10 * time.Millisecond)
+		panic("boom")
+	}
+	return imagestore.Source{ContentType: "image/jpeg"}, nil
+}
+
+// blockingImageProvider blocks until the context is done and reports its error.
+type blockingImageProvider struct {
+	done chan error
+}
+
+func (b *blockingImageProvider) GetImage(ctx context.Context, target string) (imagestore.Source, error) {
+	<-ctx.Done()
+	b.done <- ctx.Err()
+	return imagestore.Source{}, ctx.Err()
+}
+
 type imageProviderWithCounter struct {
 	counter int32 // atomic access
-	img     image.Image
+	img     imagestore.Source
 	timeout time.Duration
 }
 
 func newImageProvider(t *testing.T) *imageProviderWithCounter {
 	return &imageProviderWithCounter{
-		img:     test.SampleImage(t, 3),
+		img:     imagestore.Source{ContentType: "image/jpeg", Data: test.SampleData(t, 3)},
 		timeout: 100 * time.Millisecond,
 	}
 }
 
-func (i *imageProviderWithCounter) GetImage(ctx context.Context, target string) (image.Image, error) {
+func (i *imageProviderWithCounter) GetImage(ctx context.Context, target string) (imagestore.Source, error) {
 	atomic.AddInt32(&i.counter, 1)
 	select {
 	case <-ctx.Done():
-		return nil, ctx.Err()
+		return imagestore.Source{}, ctx.Err()
 	case <-time.After(i.timeout):
 		return i.img, nil
 	}
@@ -145,26 +301,34 @@ func (i *imageProviderWithCounter) Counter() int32 {
 }
 
 type simpleImageCache struct {
-	m    map[cache.Entity]image.Image
+	m    map[cache.Entity]cache.Item
 	lock sync.RWMutex
 }
 
-func (s *simpleImageCache) Get(key cache.Entity) (image.Image, error) {
+func (s *simpleImageCache) Get(key cache.Entity) (cache.Item, error) {
 	s.lock.RLock()
 	defer s.lock.RUnlock()
 
 	img, ok := s.m[key]
 	if !ok {
-		return nil, cache.ErrCacheMiss
+		return cache.Item{}, cache.ErrCacheMiss
 	}
 
 	return img, nil
 }
 
-func (s *simpleImageCache) Set(key cache.Entity, img image.Image) error {
+func (s *simpleImageCache) Set(key cache.Entity, img cache.Item) error {
 	s.lock.Lock()
 	defer s.lock.Unlock()
 
 	s.m[key] = img
 	return nil
 }
+
+func (s *simpleImageCache) Delete(key cache.Entity) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.m, key)
+	return nil
+}
@@ -0,0 +1,39 @@
+package signature
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImgproxySigner(t *testing.T) {
+	key, err := hex.DecodeString("943b421c9eb07c830af81030552c86009268de4e532ba2ee2eab8247c6da0881")
+	require.NoError(t, err)
+	salt, err := hex.DecodeString("520f986b998545b4785e0defbc4f3c1203f22de2374a3d53cb7a7fe9fea309c5")
+	require.NoError(t, err)
+
+	signer, err := NewImgproxySigner(ImgproxyKey{Key: []byte("new key"), Salt: []byte("new salt")}, ImgproxyKey{Key: key, Salt: salt})
+	require.NoError(t, err)
+
+	t.Run("it verifies imgproxy signatures", func(t *testing.T) {
+		path := "rs:fit:300:300/plain/http://img.example.com/pretty/image.jpg"
+		assert.NoError(t, signer.VerifyPath(path, "m3k5QADfcKPDj-SDI2AIogZbC3FlAXszuwhtWXYqavc"))
+		assert.Equal(t, ErrInvalid, signer.VerifyPath("rs:fit:300:301/plain/http://img.example.com/pretty/image.jpg", "m3k5QADfcKPDj-SDI2AIogZbC3FlAXszuwhtWXYqavc"))
+		assert.Equal(t, ErrMissing, signer.VerifyPath(path, ""))
+	})
+
+	t.Run("it signs with the first key", func(t *testing.T) {
+		path := "rs:fill:300:400/g:sm/aHR0cDovL2V4YW1wbGUuY29tLzEuanBn.png"
+		assert.NoError(t, signer.VerifyPath(path, signer.SignPath(path)))
+		assert.Equal(t, "90UxdwGRAI2bpLSHKkZculJau5ahfxfS0h3fMuQAf40", signImgproxy(ImgproxyKey{Key: key, Salt: salt}, "rs:fill:300:400:0/g:sm/aHR0cDovL2V4YW1w/bGUuY29tL2ltYWdl/cy9jdXJpb3NpdHku/anBn.png"))
+	})
+
+	t.Run("it requires keys", func(t *testing.T) {
+		_, err := NewImgproxySigner()
+		assert.Equal(t, ErrNoKeys, err)
+		_, err = NewImgproxySigner(ImgproxyKey{Salt: salt})
+		assert.Error(t, err)
+	})
+}
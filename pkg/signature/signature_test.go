@@ -0,0 +1,59 @@
+package signature
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSigner(t *testing.T) {
+	oldKey, newKey := []byte("old secret"), []byte("new secret")
+
+	oldSigner, err := NewSigner(oldKey)
+	require.NoError(t, err)
+	signer, err := NewSigner(newKey, oldKey)
+	require.NoError(t, err)
+
+	signed, err := signer.SignURL("/image/resize?width=100&url=http%3A%2F%2Fexample.com%2F1.jpg")
+	require.NoError(t, err)
+
+	u, err := url.Parse(signed)
+	require.NoError(t, err)
+
+	t.Run("it verifies own signature", func(t *testing.T) {
+		assert.NoError(t, signer.Verify(u.Path, u.Query()))
+	})
+
+	t.Run("it ignores parameter order", func(t *testing.T) {
+		reordered, err := url.ParseQuery("url=http%3A%2F%2Fexample.com%2F1.jpg&sig=" + u.Query().Get(Param) + "&width=100")
+		require.NoError(t, err)
+		assert.NoError(t, signer.Verify(u.Path, reordered))
+	})
+
+	t.Run("it accepts rotated keys", func(t *testing.T) {
+		old, err := oldSigner.SignURL("/image/resize?width=100")
+		require.NoError(t, err)
+		u, err := url.Parse(old)
+		require.NoError(t, err)
+
+		assert.NoError(t, signer.Verify(u.Path, u.Query()))
+	})
+
+	t.Run("it rejects tampered requests", func(t *testing.T) {
+		query := u.Query()
+		query.Set("width", "5000")
+		assert.Equal(t, ErrInvalid, signer.Verify(u.Path, query))
+		assert.Equal(t, ErrInvalid, signer.Verify("/image/other", u.Query()))
+
+		query = u.Query()
+		query.Del(Param)
+		assert.Equal(t, ErrMissing, signer.Verify(u.Path, query))
+	})
+
+	t.Run("it requires keys", func(t *testing.T) {
+		_, err := NewSigner()
+		assert.Equal(t, ErrNoKeys, err)
+	})
+}
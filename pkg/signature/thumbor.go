@@ -0,0 +1,53 @@
+package signature
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"net/url"
+)
+
+// ThumborSigner signs paths the way thumbor and libthumbor do: HMAC-SHA1 of the path
+// following the signature segment, encoded as padded base64url.
+type ThumborSigner struct {
+	keys [][]byte
+}
+
+// NewThumborSigner signs with the first security key and accepts signatures of any.
+func NewThumborSigner(keys ...[]byte) (ThumborSigner, error) {
+	if err := checkKeys(keys); err != nil {
+		return ThumborSigner{}, err
+	}
+	return ThumborSigner{keys: keys}, nil
+}
+
+func (s ThumborSigner) SignPath(path string) string {
+	return signThumbor(s.keys[0], path)
+}
+
+// VerifyPath checks the signature of the path as requested and of its unescaped form,
+// since clients sign image URLs either way.
+func (s ThumborSigner) VerifyPath(path, signature string) error {
+	if signature == "" {
+		return ErrMissing
+	}
+
+	paths := []string{path}
+	if unescaped, err := url.PathUnescape(path); err == nil && unescaped != path {
+		paths = append(paths, unescaped)
+	}
+	for _, key := range s.keys {
+		for _, p := range paths {
+			if hmac.Equal([]byte(signature), []byte(signThumbor(key, p))) {
+				return nil
+			}
+		}
+	}
+	return ErrInvalid
+}
+
+func signThumbor(key []byte, path string) string {
+	mac := hmac.New(sha1.New, key)
+	mac.Write([]byte(path))
+	return base64.URLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,30 @@
+package signature
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestThumborSigner(t *testing.T) {
+	signer, err := NewThumborSigner([]byte("new-security-key"), []byte("my-security-key"))
+	require.NoError(t, err)
+
+	t.Run("it verifies libthumbor signatures", func(t *testing.T) {
+		path := "300x200/my.server.com/some/path/to/image.jpg"
+		assert.NoError(t, signer.VerifyPath(path, "8ammJH8D-7tXy6kU3lTvoXlhu4o="))
+		assert.Equal(t, ErrInvalid, signer.VerifyPath("301x200/my.server.com/some/path/to/image.jpg", "8ammJH8D-7tXy6kU3lTvoXlhu4o="))
+		assert.Equal(t, ErrMissing, signer.VerifyPath(path, ""))
+	})
+
+	t.Run("it verifies unescaped paths", func(t *testing.T) {
+		signature := signer.SignPath("300x200/http://example.com/1.jpg")
+		assert.NoError(t, signer.VerifyPath("300x200/http%3A%2F%2Fexample.com%2F1.jpg", signature))
+	})
+
+	t.Run("it requires keys", func(t *testing.T) {
+		_, err := NewThumborSigner()
+		assert.Equal(t, ErrNoKeys, err)
+	})
+}
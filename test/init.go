@@ -21,12 +21,16 @@ func RootDir(t *testing.T, level int) string {
 	return dir
 }
 
-func SampleImage(t *testing.T, level int) image.Image {
+func SampleData(t *testing.T, level int) []byte {
 	const imagePath = "test/testdata/nature.jpg"
 
 	file, err := ioutil.ReadFile(path.Join(RootDir(t, level), imagePath))
 	require.NoError(t, err)
-	img, err := jpeg.Decode(bytes.NewReader(file))
+	return file
+}
+
+func SampleImage(t *testing.T, level int) image.Image {
+	img, err := jpeg.Decode(bytes.NewReader(SampleData(t, level)))
 	require.NoError(t, err)
 	return img
 }